@@ -4,10 +4,13 @@ import (
 	"flag"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 
 	"github.com/jenkins-x/lighthouse/pkg/interrupts"
 	"github.com/jenkins-x/lighthouse/pkg/logrusutil"
+	"github.com/jenkins-x/lighthouse/pkg/plugins/cat"
 	"github.com/jenkins-x/lighthouse/pkg/webhook"
 	"github.com/sirupsen/logrus"
 )
@@ -17,6 +20,8 @@ const (
 	HealthPath = "/Health"
 	// ReadyPath URL path for the HTTP endpoint that returns Ready status.
 	ReadyPath = "/Ready"
+	// PluginHealthPath is the URL path for the HTTP endpoint that returns the health of the plugins' upstream dependencies.
+	PluginHealthPath = "/Health/plugins"
 )
 
 type options struct {
@@ -84,10 +89,15 @@ func main() {
 	mux := http.NewServeMux()
 	mux.Handle(HealthPath, http.HandlerFunc(controller.Health))
 	mux.Handle(ReadyPath, http.HandlerFunc(controller.Ready))
+	mux.Handle(PluginHealthPath, http.HandlerFunc(controller.PluginHealth))
 
 	mux.Handle("/", http.HandlerFunc(controller.DefaultHandler))
 	mux.Handle(o.path, http.HandlerFunc(controller.HandleWebhookRequests))
 	mux.Handle(o.pollPath, http.HandlerFunc(controller.HandlePollingRequests))
+	mux.Handle(cat.LocalImagePath, cat.LocalImageHandler())
+	mux.Handle(cat.OfflineImagePath, cat.OfflineImageHandler())
+
+	go reloadOnHangup()
 
 	// lets serve metrics
 	metricsHandler := http.HandlerFunc(controller.Metrics)
@@ -98,6 +108,16 @@ func main() {
 	logrus.WithError(err).Errorf("failed to serve HTTP")
 }
 
+// reloadOnHangup reloads plugin secrets, such as the cat api key, on SIGHUP
+func reloadOnHangup() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		logrus.Info("Received SIGHUP, reloading plugin secrets")
+		cat.ReloadKey()
+	}
+}
+
 func serveMetrics(metricsHandler http.Handler) {
 	logrus.Info("Lighthouse is serving prometheus metrics on port 2112")
 	err := http.ListenAndServe(":2112", metricsHandler)
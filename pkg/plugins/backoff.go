@@ -0,0 +1,52 @@
+package plugins
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff computes the delays between the attempts of a retried operation,
+// each delay is Factor times the previous one, up to Max.
+type Backoff struct {
+	// Base is the delay before the second attempt
+	Base time.Duration
+	// Factor multiplies the delay after each attempt, 2 when below 1
+	Factor float64
+	// Max caps the delays, there is no cap when it is 0
+	Max time.Duration
+	// Jitter spreads each delay by up to this fraction of itself either way
+	Jitter float64
+	// Random returns a number in [0, 1) for the jitter, it defaults to math/rand
+	Random func() float64
+}
+
+// Delay returns how long to wait before the attempt, counting from 0 for the
+// first attempt which isn't delayed.
+func (b Backoff) Delay(attempt int) time.Duration {
+	if attempt < 1 || b.Base <= 0 {
+		return 0
+	}
+	factor := b.Factor
+	if factor < 1 {
+		factor = 2
+	}
+	delay := float64(b.Base) * math.Pow(factor, float64(attempt-1))
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		random := b.Random
+		if random == nil {
+			random = rand.Float64
+		}
+		delay += delay * b.Jitter * (2*random() - 1)
+	}
+	if b.Max > 0 && delay > float64(b.Max) {
+		return b.Max
+	}
+	if delay > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(delay)
+}
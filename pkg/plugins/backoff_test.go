@@ -0,0 +1,78 @@
+package plugins
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	delays := func(b Backoff, attempts int) []time.Duration {
+		var ds []time.Duration
+		for i := 0; i < attempts; i++ {
+			ds = append(ds, b.Delay(i))
+		}
+		return ds
+	}
+	cases := []struct {
+		name     string
+		backoff  Backoff
+		expected []time.Duration
+	}{
+		{
+			name:     "doubles by default",
+			backoff:  Backoff{Base: 100 * time.Millisecond},
+			expected: []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond},
+		},
+		{
+			name:     "factor",
+			backoff:  Backoff{Base: time.Second, Factor: 3},
+			expected: []time.Duration{0, time.Second, 3 * time.Second, 9 * time.Second, 27 * time.Second},
+		},
+		{
+			name:     "capped",
+			backoff:  Backoff{Base: time.Second, Max: 3 * time.Second},
+			expected: []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second},
+		},
+		{
+			name:     "no base",
+			backoff:  Backoff{Max: time.Second},
+			expected: []time.Duration{0, 0, 0},
+		},
+		{
+			name:     "jitter at the extremes",
+			backoff:  Backoff{Base: time.Second, Jitter: 0.5, Random: func() float64 { return 0 }},
+			expected: []time.Duration{0, 500 * time.Millisecond, time.Second, 2 * time.Second},
+		},
+		{
+			name:     "jitter stays under the cap",
+			backoff:  Backoff{Base: time.Second, Max: 2 * time.Second, Jitter: 0.5, Random: func() float64 { return 0.75 }},
+			expected: []time.Duration{0, 1250 * time.Millisecond, 2 * time.Second, 2 * time.Second},
+		},
+	}
+	for _, tc := range cases {
+		if got := delays(tc.backoff, len(tc.expected)); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, got)
+		}
+	}
+
+	// a seeded jitter source gives the same spread sequence every time
+	seeded := func() []time.Duration {
+		r := rand.New(rand.NewSource(1))
+		return delays(Backoff{Base: time.Second, Max: 10 * time.Second, Jitter: 0.2, Random: r.Float64}, 6)
+	}
+	first := seeded()
+	if second := seeded(); !reflect.DeepEqual(first, second) {
+		t.Errorf("expected the same delays from the same seed, got %v and %v", first, second)
+	}
+	for i, d := range first[1:] {
+		nominal := time.Second << uint(i)
+		if nominal > 10*time.Second {
+			nominal = 10 * time.Second
+		}
+		if d < nominal*8/10 || d > nominal*12/10 || d > 10*time.Second {
+			t.Errorf("attempt %d: expected a delay within 20%% of %v and under the cap, got %v", i+1, nominal, d)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package cat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x/lighthouse/pkg/errorutil"
+	"k8s.io/utils/clock"
+)
+
+// errCircuitOpen is returned without asking the providers while they keep failing
+var errCircuitOpen = fmt.Errorf("%w: too many consecutive failures, not asking again yet", errTransient)
+
+// breaker stops asking the providers for a while after consecutive failures so
+// that an outage doesn't cost every /meow a round of failing requests.
+type breaker struct {
+	lock      sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	// trial is set while the single request let through after the cooldown is in flight
+	trial bool
+	// clock is the plugin's when nil
+	clock clock.PassiveClock
+}
+
+// configure sets the number of consecutive failures opening the circuit, zero
+// disables the breaker, and how long it stays open.
+func (b *breaker) configure(threshold int, cooldown time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.threshold = threshold
+	b.cooldown = cooldown
+}
+
+func (b *breaker) time() time.Time {
+	return clockOr(b.clock).Now()
+}
+
+// allow returns false while the circuit is open. Once the cooldown is over a
+// single request is let through to find out whether the providers recovered.
+func (b *breaker) allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return true
+	}
+	if b.trial || b.time().Before(b.openUntil) {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// record counts transient failures and closes the circuit again on anything
+// else, as a provider that answered is up even when it had no suitable cat.
+func (b *breaker) record(err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.trial = false
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded), throttled(err):
+		// the caller gave up or wasn't let through, that says nothing about the providers
+	case isError(err, errTransient):
+		b.failures++
+		if b.threshold > 0 && b.failures >= b.threshold {
+			b.openUntil = b.time().Add(b.cooldown)
+		}
+	default:
+		b.failures = 0
+	}
+}
+
+// throttled returns true if the providers weren't asked because of the rate limit
+func throttled(err error) bool {
+	var agg errorutil.Aggregate
+	if errors.As(err, &agg) {
+		for _, e := range agg.Errors() {
+			if !throttled(e) {
+				return false
+			}
+		}
+		return len(agg.Errors()) > 0
+	}
+	return errors.Is(err, errThrottled)
+}
@@ -0,0 +1,132 @@
+package cat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x/lighthouse/pkg/plugins"
+	"k8s.io/utils/clock"
+)
+
+// cachingClowder can forget a cached cat, e.g. when it was already posted on
+// the issue and another one is needed
+type cachingClowder interface {
+	forget(category string, movieCat bool, maxSize, count int)
+}
+
+// imageCache remembers the last cat found for each request for a short while so
+// that bursts of /meow don't all hit the providers.
+type imageCache struct {
+	lock   sync.Mutex
+	ttl    time.Duration
+	jitter float64
+	images map[string]cachedImage
+	// clock is the plugin's when nil
+	clock  clock.PassiveClock
+	random func() float64
+}
+
+type cachedImage struct {
+	resp    string
+	expires time.Time
+}
+
+// freshKey marks the contexts of the requests that skip the cache
+type freshKey struct{}
+
+// withFresh makes the reads of the context skip the cached cats and ask the
+// providers, the cat found is still cached for the next requests
+func withFresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshKey{}, true)
+}
+
+// isFresh returns true if the reads of the context skip the cached cats
+func isFresh(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshKey{}).(bool)
+	return fresh
+}
+
+func isFreshFlag(field string) bool {
+	switch strings.ToLower(field) {
+	case "fresh", "--fresh", "nocache", "--nocache":
+		return true
+	}
+	return false
+}
+
+// freshOverride skips the cached cats for `/meow fresh` or `/meow nocache`
+func freshOverride(ctx context.Context, match plugins.CommandMatch) context.Context {
+	for _, field := range strings.Fields(match.Arg) {
+		if isFreshFlag(field) {
+			return withFresh(ctx)
+		}
+	}
+	return ctx
+}
+
+func cacheKey(category string, movieCat bool, maxSize, count int) string {
+	return fmt.Sprintf("%s|%t|%d|%d", category, movieCat, maxSize, count)
+}
+
+// configure sets how long a cat is reused for, zero disables the cache, and
+// the fraction by which the ttl of each cat is spread
+func (c *imageCache) configure(ttl time.Duration, jitter float64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.ttl = ttl
+	c.jitter = jitter
+	if ttl <= 0 {
+		c.images = nil
+	}
+}
+
+func (c *imageCache) time() time.Time {
+	return clockOr(c.clock).Now()
+}
+
+// get returns the cached cat if it hasn't expired yet
+func (c *imageCache) get(key string) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.ttl <= 0 {
+		return "", false
+	}
+	image, ok := c.images[key]
+	if !ok {
+		return "", false
+	}
+	if !c.time().Before(image.expires) {
+		delete(c.images, key)
+		return "", false
+	}
+	return image.resp, true
+}
+
+// add caches the cat, dropping the expired ones
+func (c *imageCache) add(key, resp string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.ttl <= 0 {
+		return
+	}
+	now := c.time()
+	if c.images == nil {
+		c.images = map[string]cachedImage{}
+	}
+	for k, image := range c.images {
+		if !now.Before(image.expires) {
+			delete(c.images, k)
+		}
+	}
+	c.images[key] = cachedImage{resp: resp, expires: now.Add(jittered(c.ttl, c.jitter, c.random))}
+}
+
+// remove forgets the cached cat
+func (c *imageCache) remove(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.images, key)
+}
@@ -18,50 +18,112 @@ limitations under the License.
 package cat
 
 import (
+	"context"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"html"
+	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/lighthouse/pkg/errorutil"
 	"github.com/jenkins-x/lighthouse/pkg/plugins"
+	"github.com/jenkins-x/lighthouse/pkg/plugins/imagefetch"
 	"github.com/jenkins-x/lighthouse/pkg/scmprovider"
+	"github.com/jenkins-x/lighthouse/pkg/version"
 	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/utils/clock"
 )
 
 var (
 	grumpyKeywords = regexp.MustCompile(`(?mi)^(no|grumpy)\s*$`)
 	meow           = &realClowder{
-		url: "https://api.thecatapi.com/v1/images/search?format=json&results_per_page=1",
+		url:           searchURL(defaultAPIURL),
+		breedsURL:     defaultAPIURL + "/v1/breeds",
+		categoriesURL: defaultAPIURL + "/v1/categories",
+		local:         &localImages{},
 	}
+	recent = newRecentCats(recentIssues, recentTTL)
+	health = &healthCache{}
+	// fetches bounds the cats looked for at once, see Cat.MaxConcurrentFetches
+	fetches = &fetchSlots{}
+
+	// validCategory matches the normalized categories and breeds worth asking for
+	validCategory = regexp.MustCompile(`^[a-z0-9][a-z0-9 _-]*$`)
+	// safeCategories are the thecatapi.com categories asked for in safe mode
+	safeCategories = []string{"boxes", "caturday", "clothes", "hats", "kittens", "sinks", "space", "sunglasses", "ties"}
 )
 
 const (
-	pluginName = "cat"
-	grumpyURL  = "https://upload.wikimedia.org/wikipedia/commons/e/ee/Grumpy_Cat_by_Gage_Skidmore.jpg"
+	// defaultAPIURL is the base url of thecatapi.com, see plugins.Cat.APIURL
+	defaultAPIURL              = "https://api.thecatapi.com"
+	pluginName                 = "cat"
+	grumpyURL                  = "https://upload.wikimedia.org/wikipedia/commons/e/ee/Grumpy_Cat_by_Gage_Skidmore.jpg"
+	defaultTimeout             = 10 * time.Second
+	defaultKeyReloadInterval   = time.Minute
+	defaultMaxRetryAfter       = 10 * time.Second
+	defaultHealthCheckInterval = 5 * time.Minute
+	// maxCats is the most cats that can be asked for in one comment
+	maxCats = 5
+	// maxCategoryLength is the longest category or breed name that is asked for
+	maxCategoryLength = 64
+	// catMarker identifies the comments left by this plugin
+	catMarker            = "\n<!-- lighthouse-cat -->"
+	recentIssues         = 1000
+	recentTTL            = 10 * time.Minute
+	badCategoryMessage   = "Bad category. Please see https://api.thecatapi.com/api/categories/list"
+	downMessage          = "https://thecatapi.com appears to be down"
+	noSuitableCatMessage = "Could not find a cat image that can be posted, please try again."
+	noCatsMessage        = "Couldn't find a cat right now, please try again."
+	// notMemberMessage is the reply when Cat.RequireMember rejects a request
+	notMemberMessage = "Sorry, only members of this organization can ask for cats here."
+	// collapsedSummary is shown in place of the cats with Cat.Collapsible
+	collapsedSummary = "🐱"
+	// grumpyReaction on the command comment gets the grumpy cat with Cat.GrumpyReaction
+	grumpyReaction = "-1"
+	// safeMimeTypes are the only images asked for in safe mode, gifs aside
+	safeMimeTypes = "jpg,png"
 )
 
+var defaultClient = &http.Client{Timeout: defaultTimeout}
+
 var (
 	plugin = plugins.Plugin{
 		Description:        "The cat plugin adds a cat image to an issue or PR in response to the `/meow` command.",
 		ConfigHelpProvider: configHelp,
+		HealthProvider:     healthProvider,
 		Commands: []plugins.Command{{
 			Name: "meow|meowvie",
 			Arg: &plugins.CommandArg{
-				Pattern:  `.+`,
+				Usage:    "[breed=<breed>] [count=<count>] [id=<id>] [gif] [big] [fresh] [category]",
+				Pattern:  `(?:(?:breed=(?P<breed>\S+)|count=(?P<count>\d+)|id=(?P<id>\S+)|\S+)(?:[ \t]+|$))+`,
 				Optional: true,
 			},
-			Description: "Add a cat image to the issue or PR",
+			Description: "Add a cat image to the issue or PR, add `gif` to the argument for an animated cat, a number or `count=<count>` for up to 5 cats `breed=<breed>` for a breed, `id=<id>` for a specific image, `big` for a bigger image when allowed and `fresh` or `nocache` for a cat that wasn't cached. `/meow categories` lists the categories, `/meow undo` removes the last cat, `/meow set-default <category>` lets maintainers set the category of a bare `/meow` in the repo, `/meow leaderboard` lists the top cat summoners and `/meow debug <argument>` shows maintainers the requests of a `/meow` when enabled",
+			Cooldown:    catCooldown,
+			OnCooldown:  handleCooldown,
+			DedupeEdits: true,
 			Action: plugins.
 				Invoke(handleGenericComment).
-				When(plugins.Action(scm.ActionCreate)),
+				When(plugins.Action(scm.ActionCreate, scm.ActionEdited)),
 		}},
+		Periodics: []plugins.Periodic{ofTheDay},
 	}
 )
 
@@ -70,36 +132,417 @@ func init() {
 }
 
 func configHelp(config *plugins.Configuration, enabledRepos []string) (map[string]string, error) {
-	return map[string]string{
-			"": fmt.Sprintf("The cat plugin uses an api key for thecatapi.com stored in %s.", config.Cat.KeyPath),
-		},
-		nil
+	keyLocation := config.Cat.KeyPath
+	if config.Cat.KeySecret != "" {
+		keyLocation = "the secret " + config.Cat.KeySecret
+	}
+	configInfo := map[string]string{
+		"": fmt.Sprintf("The cat plugin uses an api key for thecatapi.com stored in %s. It has the following settings:<ul>\n%s\n</ul>", keyLocation, strings.Join(settingsHelp(config.Cat), "\n")),
+	}
+	for _, orgRepo := range enabledRepos {
+		parts := strings.Split(orgRepo, "/")
+		var opts plugins.Cat
+		var enabled bool
+		switch len(parts) {
+		case 1:
+			opts, enabled = config.CatFor(orgRepo, "")
+		case 2:
+			opts, enabled = config.CatFor(parts[0], parts[1])
+		default:
+			return nil, fmt.Errorf("invalid repo in enabledRepos: %q", orgRepo)
+		}
+		var configInfoStrings []string
+		if !enabled {
+			configInfoStrings = append(configInfoStrings, "<li>The plugin is disabled.</li>")
+		}
+		if opts.RequireMember {
+			configInfoStrings = append(configInfoStrings, "<li>Only org members and collaborators can ask for cats.</li>")
+		}
+		if len(opts.AllowedCategories) > 0 {
+			configInfoStrings = append(configInfoStrings, fmt.Sprintf("<li>Only the categories %s can be asked for.</li>", strings.Join(opts.AllowedCategories, ", ")))
+		}
+		if len(configInfoStrings) > 0 {
+			configInfo[orgRepo] = "The plugin has the following configuration:<ul>\n" + strings.Join(configInfoStrings, "\n") + "\n</ul>"
+		}
+	}
+	return configInfo, nil
+}
+
+func weightsHelp(categories []plugins.WeightedCategory) string {
+	if len(categories) == 0 {
+		return "any"
+	}
+	weights := make([]string, 0, len(categories))
+	for _, category := range categories {
+		weights = append(weights, fmt.Sprintf("%s (%d)", category.Name, category.Weight))
+	}
+	return strings.Join(weights, ", ")
+}
+
+func synonymsHelp(synonyms map[string]string) string {
+	if len(synonyms) == 0 {
+		return "none"
+	}
+	described := make([]string, 0, len(synonyms))
+	for synonym, category := range synonyms {
+		described = append(described, fmt.Sprintf("%s for %s", synonym, category))
+	}
+	sort.Strings(described)
+	return strings.Join(described, ", ")
+}
+
+func messagesHelp(messages plugins.CatMessages) string {
+	var custom []string
+	for name, msg := range map[string]string{"bad_category": messages.BadCategory, "down": messages.Down, "not_found": messages.NotFound, "busy": messages.Busy} {
+		if strings.TrimSpace(msg) != "" {
+			custom = append(custom, name)
+		}
+	}
+	if len(custom) == 0 {
+		return "default"
+	}
+	sort.Strings(custom)
+	return strings.Join(custom, ", ") + " customized"
+}
+
+func imagePathsHelp(paths map[string]string) string {
+	if len(paths) == 0 {
+		return "url"
+	}
+	described := make([]string, 0, len(paths))
+	for provider, path := range paths {
+		described = append(described, fmt.Sprintf("%s for %s", path, provider))
+	}
+	sort.Strings(described)
+	return strings.Join(described, ", ")
+}
+
+func repliesHelp(replies *plugins.CatReplies) string {
+	if replies == nil {
+		return "default"
+	}
+	var overridden []string
+	if replies.Collapsible != nil {
+		overridden = append(overridden, "collapsible")
+	}
+	if replies.IncludeFact != nil {
+		overridden = append(overridden, "include_fact")
+	}
+	if replies.Template != "" {
+		overridden = append(overridden, "template")
+	}
+	if len(overridden) == 0 {
+		return "default"
+	}
+	return strings.Join(overridden, ", ") + " overridden"
+}
+
+func imageFormatsHelp(formats map[string]string) string {
+	if len(formats) == 0 {
+		return "none"
+	}
+	described := make([]string, 0, len(formats))
+	for provider, format := range formats {
+		described = append(described, fmt.Sprintf("%s for %s", format, provider))
+	}
+	sort.Strings(described)
+	return strings.Join(described, ", ")
+}
+
+func providerWeightsHelp(weights map[string]int) string {
+	if len(weights) == 0 {
+		return "in turn"
+	}
+	described := make([]string, 0, len(weights))
+	for provider, weight := range weights {
+		described = append(described, fmt.Sprintf("%d for %s", weight, provider))
+	}
+	sort.Strings(described)
+	return strings.Join(described, ", ")
+}
+
+func dimensionHelp(pixels int) string {
+	if pixels <= 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d pixels", pixels)
+}
+
+func framesHelp(frames int) string {
+	if frames <= 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d frames", frames)
+}
+
+func rateHelp(cat plugins.Cat) string {
+	limit, burst := cat.RequestRate()
+	if limit <= 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%s requests per second, bursts of %d", strconv.FormatFloat(limit, 'f', -1, 64), burst)
+}
+
+// settingsHelp lists the effective value of each of the cat settings
+func settingsHelp(cat plugins.Cat) []string {
+	orDefault := func(value, def string) string {
+		if value == "" {
+			return def
+		}
+		return value
+	}
+	durationOrDefault := func(value, def time.Duration) string {
+		if value <= 0 {
+			return def.String()
+		}
+		return value.String()
+	}
+	listOrDefault := func(values []string, def string) string {
+		if len(values) == 0 {
+			return def
+		}
+		return strings.Join(values, ", ")
+	}
+	maxSize := cat.MaxImageSizeBytes
+	if maxSize <= 0 {
+		maxSize = scmprovider.DefaultImageSizeLimit
+	}
+	proxy := "none, the HTTP_PROXY and HTTPS_PROXY environment variables are honored"
+	if cat.ProxyURL != "" {
+		proxy = "invalid"
+		if u, err := url.Parse(cat.ProxyURL); err == nil {
+			proxy = u.Redacted()
+		}
+	}
+	settings := [][2]string{
+		{"key_reload_interval", durationOrDefault(cat.KeyReloadIntervalDuration, defaultKeyReloadInterval)},
+		{"request_timeout", durationOrDefault(cat.RequestTimeoutDuration, defaultTimeout)},
+		{"retries", strconv.Itoa(cat.Attempts())},
+		{"retry_backoff", cat.RetryBackoffDuration.String()},
+		{"max_retry_after", durationOrDefault(cat.MaxRetryAfterDuration, defaultMaxRetryAfter)},
+		{"retryable_status_codes", retryableStatusHelp(cat.RetryableStatusCodes)},
+		{"max_total_time", cat.MaxTotalTimeDuration.String()},
+		{"api_url", orDefault(cat.APIURL, defaultAPIURL)},
+		{"api_version", orDefault(cat.APIVersion, "v1")},
+		{"providers", listOrDefault(cat.Providers, apiSearchURL(apiBase(cat.APIURL), cat.APIVersion))},
+		{"provider_weights", providerWeightsHelp(cat.ProviderWeights)},
+		{"image_paths", imagePathsHelp(cat.ImagePaths)},
+		{"image_format", orDefault(cat.ImageFormat, markdownFormat)},
+		{"provider_image_formats", imageFormatsHelp(cat.ProviderImageFormats)},
+		{"proxy_url", proxy},
+		{"user_agent", orDefault(cat.UserAgent, defaultUserAgent())},
+		{"max_image_size_bytes", strconv.Itoa(maxSize)},
+		{"allow_big_override", strconv.FormatBool(cat.AllowBigOverride)},
+		{"big_image_size_bytes", strconv.Itoa(cat.BigImageSizeLimit())},
+		{"max_width", dimensionHelp(cat.MaxWidth)},
+		{"max_height", dimensionHelp(cat.MaxHeight)},
+		{"max_gif_frames", framesHelp(cat.MaxGifFrames)},
+		{"allowed_image_hosts", listOrDefault(cat.AllowedImageHosts, "any")},
+		{"post_resolved_url", strconv.FormatBool(cat.PostResolvedURL)},
+		{"require_https", strconv.FormatBool(cat.HTTPSRequired())},
+		{"upgrade_http", strconv.FormatBool(cat.UpgradeHTTP)},
+		{"image_size_strategy", orDefault(cat.ImageSizeStrategy, string(scmprovider.ImageSizeHead))},
+		{"local_image_dir", orDefault(cat.LocalImageDir, "none")},
+		{"local_image_url", orDefault(cat.LocalImageURL, "none")},
+		{"offline", strconv.FormatBool(cat.Offline)},
+		{"grumpy_keywords", listOrDefault(cat.GrumpyKeywords, "no, grumpy")},
+		{"grumpy_strict", strconv.FormatBool(cat.StrictGrumpy())},
+		{"grumpy_image_url", orDefault(cat.GrumpyImageURL, grumpyURL)},
+		{"grumpy_reaction", strconv.FormatBool(cat.GrumpyReaction)},
+		{"ack_reaction", orDefault(cat.AcknowledgeReaction(), "none")},
+		{"failure_reaction", orDefault(cat.FailureReaction, "none")},
+		{"cooldown", cat.CooldownDuration.String()},
+		{"cooldown_reaction", orDefault(cat.CooldownReaction, "none")},
+		{"disable_grumpy", strconv.FormatBool(cat.DisableGrumpy)},
+		{"upload_images", strconv.FormatBool(cat.UploadImages)},
+		{"static_fallback", strconv.FormatBool(cat.StaticFallback)},
+		{"show_caption", strconv.FormatBool(cat.ShowCaption)},
+		{"collapsible", strconv.FormatBool(cat.Collapsible)},
+		{"max_comment_length", strconv.Itoa(cat.CommentLengthLimit())},
+		{"messages", messagesHelp(cat.Messages)},
+		{"leaderboard", strconv.FormatBool(cat.Leaderboard)},
+		{"pull_requests", repliesHelp(cat.PullRequests)},
+		{"issues", repliesHelp(cat.Issues)},
+		{"defaults_config_map", orDefault(cat.DefaultsConfigMap, "none, kept in memory")},
+		{"debug_command", strconv.FormatBool(cat.DebugCommand)},
+		{"include_fact", strconv.FormatBool(cat.IncludeFact)},
+		{"facts_url", orDefault(cat.FactsURL, "bundled facts")},
+		{"replace_previous", strconv.FormatBool(cat.ReplacePrevious)},
+		{"health_check_interval", durationOrDefault(cat.HealthCheckIntervalDuration, defaultHealthCheckInterval)},
+		{"breaker_threshold", strconv.Itoa(cat.BreakerFailureThreshold())},
+		{"breaker_cooldown", cat.BreakerCooldownDuration.String()},
+		{"cache_ttl", cat.CacheTTLDuration.String()},
+		{"rate_limit", rateHelp(cat)},
+		{"rate_limit_wait", cat.RateLimitWaitDuration.String()},
+		{"max_concurrent_fetches", strconv.Itoa(cat.MaxConcurrentFetches)},
+		{"fetch_queue_wait", cat.FetchQueueWaitDuration.String()},
+		{"jitter_factor", strconv.FormatFloat(cat.Jitter(), 'f', -1, 64)},
+		{"require_member", strconv.FormatBool(cat.RequireMember)},
+		{"allowed_categories", listOrDefault(cat.AllowedCategories, "any")},
+		{"category_synonyms", synonymsHelp(cat.CategorySynonyms)},
+		{"default_categories", weightsHelp(cat.DefaultCategories)},
+		{"safe_mode", strconv.FormatBool(cat.SafeMode)},
+		{"of_the_day", ofTheDayHelp(cat.OfTheDay)},
+	}
+	lines := make([]string, 0, len(settings))
+	for _, setting := range settings {
+		lines = append(lines, fmt.Sprintf("<li>%s: %s</li>", setting[0], setting[1]))
+	}
+	return lines
 }
 
-type scmProviderClient interface {
+// SCMProviderClient is the part of the scm client used by the cat plugin
+type SCMProviderClient interface {
 	CreateComment(owner, repo string, number int, pr bool, comment string) error
+	CreateCommentReply(owner, repo string, number int, pr bool, threadID, comment string) error
+	DeleteComment(org, repo string, number, ID int, pr bool) error
+	ListIssueComments(org, repo string, number int) ([]*scm.Comment, error)
+	ListPullRequestComments(org, repo string, number int) ([]*scm.Comment, error)
+	BotName() (string, error)
 	QuoteAuthorForComment(string) string
+	IsCollaborator(org, repo, user string) (bool, error)
+	IsMember(org, user string) (bool, error)
+	HasPermission(org, repo, user string, roles ...string) (bool, error)
+	CreateCommentReaction(owner, repo string, number, id int, pr bool, reaction string) error
+	UploadFile(owner, repo, name string, content []byte) (string, error)
+	ListCommentReactions(owner, repo string, number, id int, pr bool) ([]string, error)
 }
 
-type clowder interface {
-	readCat(string, bool) (string, error)
+// Clowder finds cat images, ReadCat returns the markdown for count cats of the
+// category (or breed) that are no bigger than maxSize bytes.
+type Clowder interface {
+	ReadCat(ctx context.Context, category string, movieCat bool, maxSize, count int) (string, error)
 }
 
 type realClowder struct {
-	url     string
-	lock    sync.RWMutex
-	update  time.Time
-	key     string
-	keyPath string
+	url       string
+	providers []string
+	lock      sync.RWMutex
+	update    time.Time
+	key       string
+	keyPath   string
+	keySecret string
+	proxy     string
+	client    *http.Client
+	// apiURL is the configured base url, empty for thecatapi.com
+	apiURL string
+	// apiVersion is the configured version of the api, see Cat.APIVersion
+	apiVersion string
+
+	// breedsURL lists the known breeds, breed lookups are disabled when empty
+	breedsURL  string
+	breedsLock sync.Mutex
+	breeds     map[string]string
+
+	// categoriesURL lists the known categories, see listCategories
+	categoriesURL string
+	categories    categoryList
+
+	// local serves images when no provider can be reached
+	local *localImages
+
+	grumpyKeywords *regexp.Regexp
+	grumpyURL      string
+	grumpyDisabled bool
+	showCaption    bool
+	sizeStrategy   scmprovider.ImageSizeStrategy
+	userAgent      string
+	safeMode       bool
+	maxWidth       int
+	maxHeight      int
+	maxFrames      int
+	allowedHosts   []string
+	resolveURLs    bool
+	requireHTTPS   bool
+	upgradeHTTP    bool
+
+	// imageDetails finds the size of the images, see imagefetch.Fetcher
+	imageDetails func(ctx context.Context, image string, opts scmprovider.ImageOptions) (scmprovider.ImageDetails, error)
+	// imagePaths are the json paths of the image urls by provider, see decodeImagePath
+	imagePaths map[string]string
+	// providerWeights pick the order the providers are tried in, see weightedOrder
+	providerWeights map[string]int
+	// imageFormat and providerFormats are the markup of the cats, see formatter
+	imageFormat     string
+	providerFormats map[string]string
+
+	// offline posts the bundled image, see readOfflineCat
+	offline    bool
+	offlineURL string
+
+	// the outcome of the recent reads from the providers, see Status
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastError   string
+
+	breaker breaker
+	cache   imageCache
+	limiter rateLimiter
+
+	// jitter spreads the key reloads, see jittered
+	jitter float64
+	random func() float64
+	// clock is the plugin's when nil, see pluginClock
+	clock clock.PassiveClock
+}
+
+// secretReader reads a single key of a kubernetes secret
+type secretReader interface {
+	readSecret(namespace, name, key string) (string, error)
+}
+
+type kubeSecretReader struct {
+	client corev1.SecretsGetter
+}
+
+func (r kubeSecretReader) readSecret(namespace, name, key string) (string, error) {
+	secret, err := r.client.Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s/%s has no key %s", namespace, name, key)
+	}
+	return string(value), nil
+}
+
+// parseSecretRef splits a namespace/name/key secret reference
+func parseSecretRef(ref string) (namespace, name, key string, err error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("invalid secret reference %q, expected namespace/name/key", ref)
+	}
+	return parts[0], parts[1], parts[2], nil
 }
 
-func (c *realClowder) setKey(keyPath string, log *logrus.Entry) {
+// setKey loads the api key at most once per interval, or straight away when
+// the key location changes. The secret reference takes precedence over the
+// key path when both are set.
+func (c *realClowder) setKey(keyPath, keySecret string, interval time.Duration, secrets secretReader, log *logrus.Entry) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	if !time.Now().After(c.update) {
+	changed := keyPath != c.keyPath || keySecret != c.keySecret
+	now := c.time()
+	if !changed && !now.After(c.update) {
+		return
+	}
+	if interval <= 0 {
+		interval = defaultKeyReloadInterval
+	}
+	c.update = now.Add(jittered(interval, c.jitter, c.random))
+	c.keyPath = keyPath
+	c.keySecret = keySecret
+	if keySecret != "" {
+		key, err := readKeySecret(keySecret, secrets)
+		if err == nil {
+			c.key = strings.TrimSpace(key)
+			return
+		}
+		log.WithError(err).Errorf("failed to read key from secret %s", keySecret)
+		c.key = ""
 		return
 	}
-	c.update = time.Now().Add(1 * time.Minute)
 	if keyPath == "" {
 		c.key = ""
 		return
@@ -113,109 +556,1980 @@ func (c *realClowder) setKey(keyPath string, log *logrus.Entry) {
 	c.key = ""
 }
 
-type catResult struct {
-	Image string `json:"url"`
+// time is the current time of the clowder's clock
+func (c *realClowder) time() time.Time {
+	return clockOr(c.clock).Now()
+}
+
+// reloadKey makes the next setKey reload the api key regardless of the interval
+func (c *realClowder) reloadKey() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.update = time.Time{}
+}
+
+// ReloadKey forces the api key to be reloaded when the next cat is requested,
+// e.g. after the key has been rotated.
+func ReloadKey() {
+	meow.reloadKey()
+}
+
+func readKeySecret(ref string, secrets secretReader) (string, error) {
+	namespace, name, key, err := parseSecretRef(ref)
+	if err != nil {
+		return "", err
+	}
+	if secrets == nil {
+		return "", errors.New("no kubernetes client available")
+	}
+	return secrets.readSecret(namespace, name, key)
+}
+
+// setTimeout replaces the http client when the configured timeout changes,
+// otherwise the existing client is reused.
+func (c *realClowder) setTimeout(timeout time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.updateClient(timeout, c.proxy)
+}
+
+// setProxy routes the requests of the http client through the proxy, an
+// empty proxy keeps honoring the proxy environment variables.
+func (c *realClowder) setProxy(proxy string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var timeout time.Duration
+	if c.client != nil {
+		timeout = c.client.Timeout
+	}
+	return c.updateClient(timeout, proxy)
 }
 
-func (cr catResult) Format() (string, error) {
-	if cr.Image == "" {
-		return "", errors.New("empty image url")
+// updateClient replaces the http client when the timeout or proxy changes,
+// the client is kept when the new one can't be created.
+// The caller must hold the lock.
+func (c *realClowder) updateClient(timeout time.Duration, proxy string) error {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	if c.client != nil && c.client.Timeout == timeout && c.proxy == proxy {
+		return nil
 	}
-	img, err := url.Parse(cr.Image)
+	client, err := imagefetch.NewClient(timeout, proxy)
 	if err != nil {
-		return "", fmt.Errorf("invalid image url %s: %v", cr.Image, err)
+		return err
 	}
+	c.client = client
+	c.proxy = proxy
+	return nil
+}
 
-	return fmt.Sprintf("![cat image](%s)", img), nil
+// fetcher checks images against the size limit using the http client
+func (c *realClowder) fetcher(maxSize int) imagefetch.Fetcher {
+	c.lock.RLock()
+	strategy := c.sizeStrategy
+	userAgent := c.userAgent
+	details := c.imageDetails
+	c.lock.RUnlock()
+	return imagefetch.Fetcher{Client: c.httpClient(), MaxSize: maxSize, SizeStrategy: strategy, UserAgent: userAgent, Details: details}
 }
 
-func (c *realClowder) URL(category string, movieCat bool) string {
+func (c *realClowder) httpClient() *http.Client {
 	c.lock.RLock()
 	defer c.lock.RUnlock()
-	uri := string(c.url)
-	if category != "" {
-		uri += "&category=" + url.QueryEscape(category)
+	if c.client == nil {
+		return defaultClient
 	}
-	if c.key != "" {
-		uri += "&api_key=" + url.QueryEscape(c.key)
+	return c.client
+}
+
+// configure applies the plugin configuration, other than the api key
+func (c *realClowder) configure(config plugins.Cat, log *logrus.Entry) {
+	if err := c.setTimeout(config.RequestTimeoutDuration); err != nil {
+		log.WithError(err).Error("Failed to set the cat request timeout")
 	}
-	if movieCat {
-		uri += "&mime_types=gif"
+	if err := c.setProxy(config.ProxyURL); err != nil {
+		log.WithError(err).Error("Failed to set the cat proxy")
 	}
-	return uri
+	c.setAPIURL(config.APIURL)
+	c.setAPIVersion(config.APIVersion)
+	c.setProviders(config.Providers)
+	c.setProviderWeights(config.ProviderWeights)
+	c.setImagePaths(config.ImagePaths)
+	c.setImageFormats(config.ImageFormat, config.ProviderImageFormats)
+	if c.local != nil {
+		c.local.configure(config.LocalImageDir, config.LocalImageURL)
+	}
+	c.setGrumpy(grumpyMatcher(config), config.GrumpyImageURL, config.DisableGrumpy)
+	c.setShowCaption(config.ShowCaption)
+	c.setSizeStrategy(scmprovider.ImageSizeStrategy(config.ImageSizeStrategy))
+	c.setUserAgent(config.UserAgent)
+	c.setMaxDimensions(config.MaxWidth, config.MaxHeight)
+	c.setMaxFrames(config.MaxGifFrames)
+	c.setAllowedHosts(config.AllowedImageHosts)
+	c.setResolveURLs(config.PostResolvedURL)
+	c.setHTTPS(config.HTTPSRequired(), config.UpgradeHTTP)
+	c.setSafeMode(config.SafeMode)
+	c.setOffline(config.Offline, config.LocalImageURL)
+	c.breaker.configure(config.BreakerFailureThreshold(), config.BreakerCooldownDuration)
+	c.cache.configure(config.CacheTTLDuration, config.Jitter())
+	limit, burst := config.RequestRate()
+	c.limiter.configure(limit, burst, config.RateLimitWaitDuration)
+	c.setJitter(config.Jitter())
 }
 
-func (c *realClowder) readCat(category string, movieCat bool) (string, error) {
-	cats := make([]catResult, 0)
-	uri := c.URL(category, movieCat)
-	if grumpyKeywords.MatchString(category) {
-		cats = append(cats, catResult{grumpyURL})
-	} else {
-		resp, err := http.Get(uri) // #nosec
-		if err != nil {
-			return "", fmt.Errorf("could not read cat from %s: %v", uri, err)
-		}
-		defer resp.Body.Close()
-		if sc := resp.StatusCode; sc > 299 || sc < 200 {
-			return "", fmt.Errorf("failing %d response from %s", sc, uri)
+// setJitter sets the fraction by which the key reload interval is spread
+func (c *realClowder) setJitter(jitter float64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.jitter = jitter
+}
+
+// probe asks each provider for a cat until one responds
+func (c *realClowder) probe() error {
+	if c.isOffline() {
+		return nil
+	}
+	var errs []error
+	for _, provider := range c.providerURLs() {
+		if _, err := c.fetcher(0).Get(context.Background(), c.providerURL(provider, "", false, 1)); err != nil {
+			errs = append(errs, err)
+			continue
 		}
-		if err = json.NewDecoder(resp.Body).Decode(&cats); err != nil {
-			return "", err
+		return nil
+	}
+	return errorutil.NewAggregate(errs...)
+}
+
+// apiBase is the base url of the configured api, thecatapi.com when empty
+func apiBase(apiURL string) string {
+	if apiURL == "" {
+		return defaultAPIURL
+	}
+	return strings.TrimSuffix(apiURL, "/")
+}
+
+// searchURL is the image search url of the api at the base url
+func searchURL(base string) string {
+	return base + "/v1/images/search?format=json&results_per_page=1"
+}
+
+// setAPIURL points the image search, breeds and categories at the api served
+// from the base url, thecatapi.com when empty. The breeds and categories
+// known to the previous api are forgotten.
+func (c *realClowder) setAPIURL(base string) {
+	c.lock.Lock()
+	if base == c.apiURL {
+		c.lock.Unlock()
+		return
+	}
+	c.apiURL = base
+	base = apiBase(base)
+	c.url = apiSearchURL(base, c.apiVersion)
+	c.breedsURL = base + "/v1/breeds"
+	c.categoriesURL = base + "/v1/categories"
+	c.breeds = nil
+	c.lock.Unlock()
+
+	c.categories.lock.Lock()
+	defer c.categories.lock.Unlock()
+	c.categories.names = nil
+}
+
+// setProviders sets the ordered list of provider URLs to query,
+// an empty list only queries the default url.
+func (c *realClowder) setProviders(providers []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.providers = providers
+}
+
+// setProviderWeights sets the weights the order of the providers is picked
+// with, the providers are tried in turn when there are none
+func (c *realClowder) setProviderWeights(weights map[string]int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.providerWeights = weights
+}
+
+// attemptProviders returns the providers in the order an attempt tries them in
+func (c *realClowder) attemptProviders() []string {
+	providers := c.providerURLs()
+	c.lock.RLock()
+	weights, random := c.providerWeights, c.random
+	c.lock.RUnlock()
+	if len(weights) == 0 {
+		return providers
+	}
+	return weightedOrder(providers, weights, random)
+}
+
+// weightedOrder orders the providers at random in proportion to their weights,
+// each provider comes once so that the others are still tried after one fails.
+// Providers without a weight weigh 1, those weighing 0 come last in turn.
+// random returns a number in [0, 1) and defaults to math/rand.
+func weightedOrder(providers []string, weights map[string]int, random func() float64) []string {
+	if random == nil {
+		random = rand.Float64
+	}
+	var weighted, last []string
+	total := 0
+	for _, p := range providers {
+		w := weight(weights, p)
+		if w <= 0 {
+			last = append(last, p)
+			continue
 		}
-		if len(cats) < 1 {
-			return "", fmt.Errorf("no cats in response from %s", uri)
+		weighted = append(weighted, p)
+		total += w
+	}
+	order := make([]string, 0, len(providers))
+	for len(weighted) > 0 {
+		n := int(random() * float64(total))
+		i := 0
+		for ; i < len(weighted)-1; i++ {
+			w := weight(weights, weighted[i])
+			if n < w {
+				break
+			}
+			n -= w
 		}
+		order = append(order, weighted[i])
+		total -= weight(weights, weighted[i])
+		weighted = append(weighted[:i:i], weighted[i+1:]...)
 	}
-	a := cats[0]
-	if a.Image == "" {
-		return "", fmt.Errorf("no image url in response from %s", uri)
+	return append(order, last...)
+}
+
+// weight is the weight of the provider, 1 when it has none
+func weight(weights map[string]int, provider string) int {
+	if w, ok := weights[provider]; ok {
+		return w
 	}
-	// checking size, GitHub doesn't support big images
-	toobig, err := scmprovider.ImageTooBig(a.Image)
-	if err != nil {
-		return "", fmt.Errorf("could not validate image size %s: %v", a.Image, err)
-	} else if toobig {
-		return "", fmt.Errorf("longcat is too long: %s", a.Image)
+	return 1
+}
+
+// setGrumpy overrides the grumpy keywords and image, nil and empty values
+// keep the defaults. Disabled treats the keywords as any other category.
+func (c *realClowder) setGrumpy(keywords *regexp.Regexp, image string, disabled bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.grumpyKeywords = keywords
+	c.grumpyURL = image
+	c.grumpyDisabled = disabled
+}
+
+// setShowCaption sets whether the breed is shown under the image
+func (c *realClowder) setShowCaption(show bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.showCaption = show
+}
+
+// defaultUserAgent identifies the lighthouse build to the cat providers
+func defaultUserAgent() string {
+	if version.Version == "" {
+		return "lighthouse-cat"
 	}
-	return a.Format()
+	return "lighthouse-cat/" + version.Version
 }
 
-func handleGenericComment(match plugins.CommandMatch, pc plugins.Agent, e scmprovider.GenericCommentEvent) error {
-	return handle(
-		match.Name == "meowvie",
-		match.Arg,
-		pc.SCMProviderClient,
-		pc.Logger,
-		&e,
-		meow,
-		func() { meow.setKey(pc.PluginConfig.Cat.KeyPath, pc.Logger) },
-	)
+// setUserAgent sets the User-Agent of the outbound requests, the default when empty
+func (c *realClowder) setUserAgent(userAgent string) {
+	if userAgent == "" {
+		userAgent = defaultUserAgent()
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.userAgent = userAgent
 }
 
-func handle(movieCat bool, category string, spc scmProviderClient, log *logrus.Entry, e *scmprovider.GenericCommentEvent, c clowder, setKey func()) error {
-	// Now that we know this is a relevant event we can set the key.
-	setKey()
+// setMaxDimensions sets the largest images posted in pixels, zero for no limit
+func (c *realClowder) setMaxDimensions(width, height int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.maxWidth = width
+	c.maxHeight = height
+}
 
-	org := e.Repo.Namespace
-	repo := e.Repo.Name
-	number := e.Number
+// checkDimensions fails with errTooBig for images over the maximum dimensions,
+// the dimensions the provider didn't give are not checked.
+func (c *realClowder) checkDimensions(cat catResult) error {
+	c.lock.RLock()
+	maxWidth, maxHeight := c.maxWidth, c.maxHeight
+	c.lock.RUnlock()
+	if (maxWidth > 0 && cat.Width > maxWidth) || (maxHeight > 0 && cat.Height > maxHeight) {
+		return fmt.Errorf("%w: %s is %dx%d pixels", errTooBig, cat.Image, cat.Width, cat.Height)
+	}
+	return nil
+}
 
-	for i := 0; i < 3; i++ {
-		resp, err := c.readCat(category, movieCat)
-		if err != nil {
-			log.WithError(err).Error("Failed to get cat img")
-			continue
+// setMaxFrames sets the most frames of the gifs posted, zero for no limit
+func (c *realClowder) setMaxFrames(frames int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.maxFrames = frames
+}
+
+// checkFrames fails with errTooBig for gifs with too many frames, they are
+// counted in the gif when the provider doesn't say. Gifs that can't be
+// counted are not checked.
+func (c *realClowder) checkFrames(ctx context.Context, f imagefetch.Fetcher, cat catResult) error {
+	c.lock.RLock()
+	maxFrames := c.maxFrames
+	c.lock.RUnlock()
+	if maxFrames <= 0 {
+		return nil
+	}
+	frames := cat.Frames
+	if frames <= 0 {
+		var err error
+		frames, err = f.GifFrames(ctx, cat.Image, maxFrames)
+		if err != nil && frames <= maxFrames {
+			logrus.WithField("plugin", pluginName).WithError(err).Debugf("Could not count the frames of %s", cat.Image)
+			return nil
 		}
-		return spc.CreateComment(org, repo, number, e.IsPR, plugins.FormatResponseRaw(e.Body, e.Link, spc.QuoteAuthorForComment(e.Author.Login), resp))
 	}
+	if frames > maxFrames {
+		return fmt.Errorf("%w: %s has more than %d frames", errTooBig, cat.Image, maxFrames)
+	}
+	return nil
+}
 
-	var msg string
-	if category != "" {
-		msg = "Bad category. Please see https://api.thecatapi.com/api/categories/list"
-	} else {
-		msg = "https://thecatapi.com appears to be down"
+// setAllowedHosts restricts the hosts the images are posted from, any host
+// is allowed when empty
+func (c *realClowder) setAllowedHosts(hosts []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.allowedHosts = hosts
+}
+
+// setResolveURLs sets whether the images are posted from where their redirects lead
+func (c *realClowder) setResolveURLs(resolve bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.resolveURLs = resolve
+}
+
+// setHTTPS sets whether only https images are posted, upgrading the http ones
+// rather than turning them down
+func (c *realClowder) setHTTPS(require, upgrade bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.requireHTTPS = require
+	c.upgradeHTTP = upgrade
+}
+
+// checkScheme fails with errInvalid for http images when https is required,
+// unless they are upgraded to https. The image to check further is returned.
+func (c *realClowder) checkScheme(image string) (string, error) {
+	c.lock.RLock()
+	require, upgrade := c.requireHTTPS, c.upgradeHTTP
+	c.lock.RUnlock()
+	if !require {
+		return image, nil
+	}
+	u, err := url.Parse(image)
+	if err != nil {
+		return image, fmt.Errorf("%w: invalid image url %s: %v", errInvalid, image, err)
+	}
+	switch {
+	case strings.EqualFold(u.Scheme, "https"):
+		return image, nil
+	case strings.EqualFold(u.Scheme, "http") && upgrade:
+		u.Scheme = "https"
+		return u.String(), nil
+	}
+	return image, fmt.Errorf("%w: %s is not served over https", errInvalid, image)
+}
+
+// resolve validates the image, with resolveURLs the image is then the url its
+// redirects lead to, whose host has to be allowed too.
+func (c *realClowder) resolve(ctx context.Context, f imagefetch.Fetcher, cat *catResult) error {
+	details, err := f.Inspect(ctx, cat.Image)
+	if err != nil {
+		return err
+	}
+	cat.MimeType = details.ContentType
+	cat.Size = details.Size
+	c.lock.RLock()
+	resolve := c.resolveURLs
+	c.lock.RUnlock()
+	resolved := details.URL
+	if !resolve || resolved == cat.Image {
+		return nil
+	}
+	if resolved, err = c.checkScheme(resolved); err != nil {
+		return err
+	}
+	if err := c.checkHost(resolved); err != nil {
+		return err
+	}
+	cat.Image = resolved
+	return nil
+}
+
+// checkHost fails with errInvalid for images from hosts that aren't allowed,
+// the grumpy cat's host is allowed unless the grumpy cat is disabled.
+func (c *realClowder) checkHost(image string) error {
+	c.lock.RLock()
+	allowed := c.allowedHosts
+	if len(allowed) > 0 && !c.grumpyDisabled {
+		grumpy := c.grumpyURL
+		if grumpy == "" {
+			grumpy = grumpyURL
+		}
+		if u, err := url.Parse(grumpy); err == nil && u.Hostname() != "" {
+			allowed = append([]string{u.Hostname()}, allowed...)
+		}
+	}
+	c.lock.RUnlock()
+	if len(allowed) == 0 {
+		return nil
+	}
+	u, err := url.Parse(image)
+	if err != nil {
+		return fmt.Errorf("%w: invalid image url %s: %v", errInvalid, image, err)
 	}
-	if err := spc.CreateComment(org, repo, number, e.IsPR, plugins.FormatResponseRaw(e.Body, e.Link, spc.QuoteAuthorForComment(e.Author.Login), msg)); err != nil {
+	host := strings.ToLower(u.Hostname())
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+		if host == a || strings.HasSuffix(host, "."+a) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not on an allowed host", errInvalid, image)
+}
+
+// setSizeStrategy sets how the size of an image is found before posting it
+func (c *realClowder) setSizeStrategy(strategy scmprovider.ImageSizeStrategy) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.sizeStrategy = strategy
+}
+
+// setSafeMode sets whether only the safe categories and image types are asked for
+func (c *realClowder) setSafeMode(safe bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.safeMode = safe
+}
+
+func (c *realClowder) caption() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.showCaption
+}
+
+// grumpyImage returns the grumpy image if the category is a grumpy keyword
+func (c *realClowder) grumpyImage(category string) (string, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.grumpyDisabled {
+		return "", false
+	}
+	keywords := grumpyKeywords
+	if c.grumpyKeywords != nil {
+		keywords = c.grumpyKeywords
+	}
+	if !keywords.MatchString(category) {
+		return "", false
+	}
+	if c.grumpyURL != "" {
+		return c.grumpyURL, true
+	}
+	return grumpyURL, true
+}
+
+func (c *realClowder) providerURLs() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if len(c.providers) == 0 {
+		return []string{c.url}
+	}
+	return c.providers
+}
+
+type breed struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// loadBreeds fetches the known breeds once, a failed fetch is retried on
+// the next call.
+func (c *realClowder) loadBreeds(ctx context.Context) error {
+	c.breedsLock.Lock()
+	defer c.breedsLock.Unlock()
+	c.lock.RLock()
+	loaded := c.breeds != nil
+	breedsURL := c.breedsURL
+	uri := breedsURL
+	if uri != "" && c.key != "" {
+		uri += "?api_key=" + url.QueryEscape(c.key)
+	}
+	c.lock.RUnlock()
+	if loaded || breedsURL == "" {
+		return nil
+	}
+	if err := c.limiter.take(ctx); err != nil {
+		return err
+	}
+
+	req, err := c.fetcher(0).NewRequest(ctx, http.MethodGet, uri)
+	if err != nil {
+		return fmt.Errorf("could not create request for %s: %w", breedsURL, err)
+	}
+	imagefetch.AcceptCompressed(req)
+	resp, err := c.httpClient().Do(req) // #nosec
+	if err != nil {
+		return fmt.Errorf("could not read breeds from %s: %w", breedsURL, err)
+	}
+	defer resp.Body.Close()
+	if sc := resp.StatusCode; sc > 299 || sc < 200 {
+		return fmt.Errorf("failing %d response from %s", sc, breedsURL)
+	}
+	body, err := imagefetch.DecodedBody(resp)
+	if err != nil {
+		return fmt.Errorf("could not read breeds from %s: %w", breedsURL, err)
+	}
+	defer body.Close()
+	var list []breed
+	if err := json.NewDecoder(body).Decode(&list); err != nil {
+		return fmt.Errorf("could not decode breeds from %s: %w", breedsURL, err)
+	}
+	breeds := make(map[string]string, 2*len(list))
+	for _, b := range list {
+		if b.ID == "" {
+			continue
+		}
+		breeds[strings.ToLower(b.ID)] = b.ID
+		if b.Name != "" {
+			breeds[strings.ToLower(b.Name)] = b.ID
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// the api may have changed while the breeds were read
+	if c.breedsURL == breedsURL {
+		c.breeds = breeds
+	}
+	return nil
+}
+
+// breedID returns the id of the breed matching the name or id, if known.
+// The caller must hold the lock.
+func (c *realClowder) breedID(name string) (string, bool) {
+	id, ok := c.breeds[strings.ToLower(strings.TrimSpace(name))]
+	return id, ok
+}
+
+func (c *realClowder) readLocalCat() (string, error) {
+	if c.local == nil {
+		return "", errLocalDisabled
+	}
+	return c.local.readLocalCat()
+}
+
+// recentCats remembers the images recently posted on each issue so that the
+// same cat is not posted twice.
+type recentCats struct {
+	lock  sync.Mutex
+	cache *lru.Cache
+	ttl   time.Duration
+}
+
+// newRecentCats tracks the images posted on up to size issues for ttl.
+// It panics if size is not positive.
+func newRecentCats(size int, ttl time.Duration) *recentCats {
+	cache, err := lru.New(size)
+	if err != nil {
+		panic(err)
+	}
+	return &recentCats{cache: cache, ttl: ttl}
+}
+
+// seen returns true if any of the images was posted on the issue within the
+// ttl, the images being the urls of a cat rather than its markdown so that
+// the same cat with another caption or size is seen too.
+func (r *recentCats) seen(issue string, images ...string) bool {
+	if r == nil {
+		return false
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	v, ok := r.cache.Get(issue)
+	if !ok {
+		return false
+	}
+	for _, image := range images {
+		if posted, ok := v.(map[string]time.Time)[image]; ok && pluginClock.Since(posted) < r.ttl {
+			return true
+		}
+	}
+	return false
+}
+
+// add records the images as posted on the issue, dropping expired entries
+func (r *recentCats) add(issue string, images ...string) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	posted := map[string]time.Time{}
+	if v, ok := r.cache.Get(issue); ok {
+		posted = v.(map[string]time.Time)
+	}
+	for image, at := range posted {
+		if pluginClock.Since(at) >= r.ttl {
+			delete(posted, image)
+		}
+	}
+	for _, image := range images {
+		posted[image] = pluginClock.Now()
+	}
+	r.cache.Add(issue, posted)
+}
+
+type catResult struct {
+	Image  string  `json:"url"`
+	Breeds []breed `json:"breeds,omitempty"`
+	// Width and Height are in pixels, zero when the provider doesn't say
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Frames is the number of frames of a gif, zero when the provider doesn't say
+	Frames int `json:"frames,omitempty"`
+
+	// Provider is the url the cat was found with, empty when it wasn't searched for
+	Provider string `json:"-"`
+	// MimeType and Size are those of the image once it was checked, empty when
+	// it wasn't
+	MimeType string `json:"-"`
+	Size     int    `json:"-"`
+}
+
+// Format returns the markdown for the image, followed by the breeds when
+// a caption is requested and the breeds are known.
+func (cr catResult) Format(caption bool) (string, error) {
+	return cr.FormatWith(imagefetch.Markdown, caption)
+}
+
+// FormatWith is Format with the image in the markup of the formatter
+func (cr catResult) FormatWith(image imageFormatter, caption bool) (string, error) {
+	md, err := image("cat image", cr.Image)
+	if err != nil || !caption {
+		return md, err
+	}
+	var names []string
+	for _, b := range cr.Breeds {
+		if b.Name != "" {
+			names = append(names, b.Name)
+		}
+	}
+	if len(names) == 0 {
+		return md, nil
+	}
+	return fmt.Sprintf("%s\n\nBreed: %s", md, strings.Join(names, ", ")), nil
+}
+
+// catResults are formatted as one image after another
+type catResults []catResult
+
+// Format returns the markdown for all of the images
+func (cs catResults) Format(caption bool) (string, error) {
+	return cs.FormatWith(func(string) imageFormatter { return imagefetch.Markdown }, caption)
+}
+
+// FormatWith is Format with each image in the markup of the formatter of the
+// provider it was found with
+func (cs catResults) FormatWith(formatter func(provider string) imageFormatter, caption bool) (string, error) {
+	if len(cs) == 0 {
+		return "", errors.New("no cats")
+	}
+	images := make([]string, 0, len(cs))
+	for _, cr := range cs {
+		md, err := cr.FormatWith(formatter(cr.Provider), caption)
+		if err != nil {
+			return "", err
+		}
+		images = append(images, md)
+	}
+	return strings.Join(images, "\n\n"), nil
+}
+
+// fitComment renders the markdown of the cats as a comment, leaving out the
+// last cats and then the caption of the first one until the comment is no
+// longer than max bytes. The first image is always kept, fits is false when
+// the comment is still too long.
+func fitComment(md string, max int, render func(string) string) (comment string, fits bool) {
+	comment = render(md)
+	if len(comment) <= max {
+		return comment, true
+	}
+	starts := markdownImage.FindAllStringIndex(md, -1)
+	if len(starts) == 0 {
+		return comment, false
+	}
+	for n := len(starts) - 1; n > 0; n-- {
+		comment = render(strings.TrimSpace(md[:starts[n][0]]))
+		if len(comment) <= max {
+			return comment, true
+		}
+	}
+	comment = render(md[starts[0][0]:starts[0][1]])
+	return comment, len(comment) <= max
+}
+
+// collapsed puts the markdown in a collapsed details block, the blank lines
+// let GitHub and GitLab render the markdown within the html.
+func collapsed(md string) string {
+	return fmt.Sprintf("<details><summary>%s</summary>\n\n%s\n\n</details>", collapsedSummary, md)
+}
+
+// templated renders the markdown of the cats with the template of the replies,
+// the cats are posted alone when there is none or it fails to render.
+func templated(tmpl *template.Template, log *logrus.Entry, md, author string) string {
+	if tmpl == nil {
+		return md
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, struct{ Cats, Author string }{Cats: md, Author: author}); err != nil {
+		log.WithError(err).Warn("Failed to render the cat reply template, posting the cats alone")
+		return md
+	}
+	return out.String()
+}
+
+// markdownImage matches the images of the cats, markdown images or the img
+// tags of imagefetch.HTML
+var markdownImage = regexp.MustCompile(`!\[[^\]]*\]\(([^)\s]+)\)|<img src="([^"]+)"[^>]*>`)
+
+// imageURLs returns the urls of the images in the markdown
+func imageURLs(md string) []string {
+	var urls []string
+	for _, m := range markdownImage.FindAllStringSubmatch(md, -1) {
+		if m[1] != "" {
+			urls = append(urls, m[1])
+		} else {
+			urls = append(urls, html.UnescapeString(m[2]))
+		}
+	}
+	return urls
+}
+
+// maxSnippet is the most bytes of a response that can't be decoded shown in
+// the error
+const maxSnippet = 200
+
+// decodeError wraps the error decoding a response with the start of the
+// response. A truncated response is transient as the next one may be whole,
+// any other is errInvalid.
+func decodeError(where string, body []byte, err error) error {
+	if truncated(err) {
+		return imagefetch.Transient(fmt.Errorf("truncated %s after %d bytes: %v, the response began with %q", where, len(body), err, snippet(body)))
+	}
+	return fmt.Errorf("%w in %s: %v, the response began with %q", errInvalid, where, err, snippet(body))
+}
+
+// truncated returns true if the error is the end of a response that stopped
+// before the json or xml did
+func truncated(err error) bool {
+	var jsonErr *json.SyntaxError
+	if errors.As(err, &jsonErr) {
+		return jsonErr.Error() == "unexpected end of JSON input"
+	}
+	var xmlErr *xml.SyntaxError
+	if errors.As(err, &xmlErr) {
+		return xmlErr.Msg == "unexpected EOF"
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// snippet is the start of the body, at most maxSnippet bytes of it
+func snippet(body []byte) string {
+	if len(body) <= maxSnippet {
+		return string(body)
+	}
+	return strings.ToValidUTF8(string(body[:maxSnippet]), "") + "…"
+}
+
+// decodeCats accepts either a list of results or a single result object
+func decodeCats(body []byte) ([]catResult, error) {
+	cats := make([]catResult, 0)
+	err := json.Unmarshal(body, &cats)
+	if err == nil {
+		return cats, nil
+	}
+	var cat catResult
+	if json.Unmarshal(body, &cat) != nil {
+		return nil, err
+	}
+	return []catResult{cat}, nil
+}
+
+func (c *realClowder) URL(category string, movieCat bool) string {
+	if id, ok := catID(category); ok {
+		return c.imageURL(id)
+	}
+	c.lock.RLock()
+	uri := c.url
+	c.lock.RUnlock()
+	return c.providerURL(uri, category, movieCat, 1)
+}
+
+func (c *realClowder) providerURL(provider, category string, movieCat bool, count int) string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	uri := provider
+	addParam := func(param string) {
+		if strings.Contains(uri, "?") {
+			uri += "&" + param
+		} else {
+			uri += "?" + param
+		}
+	}
+	if c.safeMode {
+		// only the vetted categories and image types are ever asked for
+		if !isSafeCategory(category) {
+			random := c.random
+			if random == nil {
+				random = rand.Float64
+			}
+			category = safeCategories[int(random()*float64(len(safeCategories)))]
+		}
+		addParam("category=" + url.QueryEscape(category))
+	} else if id, ok := c.breedID(category); ok {
+		addParam("breed_ids=" + url.QueryEscape(id))
+	} else if category != "" {
+		addParam("category=" + url.QueryEscape(category))
+	}
+	if c.key != "" {
+		addParam("api_key=" + url.QueryEscape(c.key))
+	}
+	// the older api names the image types and the number of results differently
+	types, limit := "mime_types=", "limit="
+	if c.apiVersion == legacyAPIVersion {
+		types, limit = "type=", "results_per_page="
+	}
+	if movieCat {
+		addParam(types + "gif")
+	} else if c.safeMode {
+		addParam(types + url.QueryEscape(safeMimeTypes))
+	}
+	if count > 1 {
+		addParam(limit + strconv.Itoa(count))
+	}
+	return uri
+}
+
+func (c *realClowder) ReadCat(ctx context.Context, category string, movieCat bool, maxSize, count int) (string, error) {
+	if c.isOffline() {
+		return c.readOfflineCat()
+	}
+	if grumpy, ok := c.grumpyImage(category); ok {
+		cats, err := c.readGrumpy(ctx, grumpy, maxSize)
+		if err != nil {
+			return "", err
+		}
+		return c.format(cats)
+	}
+	key := cacheKey(category, movieCat, maxSize, count)
+	if resp, ok := c.cache.get(key); ok && !isFresh(ctx) {
+		recordRead(sourceCache, nil)
+		return resp, nil
+	}
+	cats, err := c.readCats(ctx, category, movieCat, maxSize, count)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.format(cats)
+	if err == nil {
+		c.cache.add(key, resp)
+	}
+	return resp, err
+}
+
+// readCats returns the cats ReadCat formats, asking the providers or for the
+// cat with the id
+func (c *realClowder) readCats(ctx context.Context, category string, movieCat bool, maxSize, count int) (catResults, error) {
+	if !c.breaker.allow() {
+		recordRead(sourceAPI, errCircuitOpen)
+		return nil, errCircuitOpen
+	}
+	var cats catResults
+	var err error
+	if id, ok := catID(category); ok {
+		cats, err = c.readCatByID(ctx, id, maxSize)
+		recordRead(sourceAPI, err)
+	} else {
+		cats, err = c.readProviders(ctx, category, movieCat, maxSize, count)
+	}
+	c.breaker.record(err)
+	c.recordOutcome(err)
+	return cats, err
+}
+
+// grumpyClowder can find the grumpy cat whatever the category
+type grumpyClowder interface {
+	readGrumpyCat(ctx context.Context, maxSize int) (string, error)
+}
+
+// readGrumpyCat returns the markdown for the grumpy cat
+func (c *realClowder) readGrumpyCat(ctx context.Context, maxSize int) (string, error) {
+	c.lock.RLock()
+	grumpy := c.grumpyURL
+	disabled := c.grumpyDisabled
+	c.lock.RUnlock()
+	if disabled {
+		return "", errors.New("the grumpy cat is disabled")
+	}
+	if grumpy == "" {
+		grumpy = grumpyURL
+	}
+	cats, err := c.readGrumpy(ctx, grumpy, maxSize)
+	if err != nil {
+		return "", err
+	}
+	return c.format(cats)
+}
+
+// readGrumpy checks the grumpy image as any other cat, falling back to the
+// embedded grumpy cat when it can't be posted, e.g. once it grew too big.
+func (c *realClowder) readGrumpy(ctx context.Context, grumpy string, maxSize int) (catResults, error) {
+	image, err := c.checkScheme(grumpy)
+	var details scmprovider.ImageDetails
+	if err == nil {
+		details, err = c.fetcher(maxSize).Inspect(ctx, image)
+	}
+	recordRead(sourceGrumpy, err)
+	if err == nil {
+		return catResults{{Image: image, MimeType: details.ContentType, Size: details.Size}}, nil
+	}
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	embedded, embeddedErr := c.embeddedGrumpyCat()
+	if embeddedErr != nil {
+		return nil, err
+	}
+	logrus.WithField("plugin", pluginName).WithError(err).Warnf("The grumpy image %s can't be posted, posting the embedded one instead", grumpy)
+	return embedded, nil
+}
+
+// ClowderStatus is the outcome of the recent reads from the cat providers
+type ClowderStatus struct {
+	// LastSuccess is when a read last succeeded, zero if none did
+	LastSuccess time.Time
+	// LastFailure is when a read last failed, zero if none did
+	LastFailure time.Time
+	// LastError is the error of the last failed read
+	LastError string
+}
+
+// String summarizes the status relative to now
+func (s ClowderStatus) String() string {
+	ago := func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return pluginClock.Since(t).Round(time.Second).String() + " ago"
+	}
+	summary := fmt.Sprintf("last success %s, last failure %s", ago(s.LastSuccess), ago(s.LastFailure))
+	if s.LastError != "" {
+		summary += ": " + s.LastError
+	}
+	return summary
+}
+
+// Status returns the outcome of the recent reads of the cat plugin, e.g. to
+// find out for how long thecatapi.com has been failing.
+func Status() ClowderStatus {
+	return meow.status()
+}
+
+func (c *realClowder) status() ClowderStatus {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return ClowderStatus{LastSuccess: c.lastSuccess, LastFailure: c.lastFailure, LastError: c.lastError}
+}
+
+// recordOutcome remembers when the providers last answered and failed, reads
+// given up by the caller say nothing about them.
+func (c *realClowder) recordOutcome(err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	now := c.time()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err == nil {
+		c.lastSuccess = now
+		return
+	}
+	c.lastFailure = now
+	c.lastError = err.Error()
+}
+
+// forget drops the cached cat so that the next read asks the providers
+func (c *realClowder) forget(category string, movieCat bool, maxSize, count int) {
+	c.cache.remove(cacheKey(category, movieCat, maxSize, count))
+}
+
+// readProviders asks each provider in turn until there are enough cats
+func (c *realClowder) readProviders(ctx context.Context, category string, movieCat bool, maxSize, count int) (catResults, error) {
+	if category != "" {
+		if err := c.loadBreeds(ctx); err != nil {
+			logrus.WithField("plugin", pluginName).WithError(err).Warn("Failed to load cat breeds, treating argument as a category")
+		}
+	}
+	if count < 1 {
+		count = 1
+	}
+	var cats catResults
+	seen := map[string]bool{}
+	var errs []error
+	for _, provider := range c.attemptProviders() {
+		// a provider may return fewer cats than asked for, so ask again
+		// until there are enough or it has nothing new to offer
+		for i := 0; i < count && len(cats) < count; i++ {
+			found, err := c.readCatFrom(ctx, provider, category, movieCat, maxSize, count-len(cats))
+			recordRead(sourceAPI, err)
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			added := false
+			for _, a := range found {
+				if !seen[a.Image] && len(cats) < count {
+					seen[a.Image] = true
+					cats = append(cats, a)
+					added = true
+				}
+			}
+			if !added {
+				break
+			}
+		}
+		if len(cats) == count {
+			break
+		}
+	}
+	if len(cats) > 0 {
+		return cats, nil
+	}
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	return nil, errorutil.NewAggregate(errs...)
+}
+
+// readCatFrom returns the valid cats in a response from the provider
+func (c *realClowder) readCatFrom(ctx context.Context, provider, category string, movieCat bool, maxSize, count int) ([]catResult, error) {
+	if err := c.limiter.take(ctx); err != nil {
+		return nil, err
+	}
+	uri := c.providerURL(provider, category, movieCat, count)
+	f := c.fetcher(maxSize)
+	start := c.time()
+	body, err := f.Get(ctx, uri)
+	apiLatency.Observe(c.time().Sub(start).Seconds())
+	var statusErr *imagefetch.StatusError
+	if category != "" && errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusBadRequest || statusErr.StatusCode == http.StatusNotFound) {
+		return nil, fmt.Errorf("%w %q: %v", errBadCategory, category, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cats []catResult
+	if path := c.imagePath(provider); path != "" {
+		cats, err = decodeImagePath(body, path)
+	} else if c.legacyAPI() {
+		cats, err = decodeLegacyCats(body)
+	} else {
+		cats, err = decodeCats(body)
+	}
+	if err != nil {
+		return nil, decodeError("response from "+uri, body, err)
+	}
+	if len(cats) < 1 {
+		if category != "" {
+			return nil, fmt.Errorf("%w %q: no cats in response from %s", errBadCategory, category, uri)
+		}
+		return nil, fmt.Errorf("%w in response from %s", errNoCats, uri)
+	}
+	var valid []catResult
+	var firstErr error
+	for _, a := range cats {
+		var err error
+		a.Provider = provider
+		a.Image, err = c.checkScheme(a.Image)
+		if err == nil {
+			err = c.checkHost(a.Image)
+		}
+		if err == nil {
+			err = c.checkDimensions(a)
+		}
+		if err == nil {
+			err = c.resolve(ctx, f, &a)
+		}
+		if err == nil && movieCat {
+			err = c.checkFrames(ctx, f, a)
+		}
+		if err != nil {
+			logTooBig(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		valid = append(valid, a)
+		if len(valid) == count {
+			break
+		}
+	}
+	if len(valid) == 0 {
+		return nil, firstErr
+	}
+	return valid, nil
+}
+
+// logTooBig logs by how much a rejected image was over the limit, which helps
+// to tune the limit
+func logTooBig(err error) {
+	var tooBig *imagefetch.TooBigError
+	if !errors.As(err, &tooBig) {
+		return
+	}
+	logrus.WithField("plugin", pluginName).WithFields(logrus.Fields{
+		"image": tooBig.URI,
+		"size":  tooBig.Size,
+		"limit": tooBig.Limit,
+	}).Info("Rejected a cat that is too big")
+}
+
+// isError is errors.Is that also looks inside aggregated errors
+func isError(err, target error) bool {
+	if errors.Is(err, target) {
+		return true
+	}
+	var agg errorutil.Aggregate
+	if !errors.As(err, &agg) {
+		return false
+	}
+	for _, e := range agg.Errors() {
+		if isError(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldRetry returns false when asking again is bound to fail the same way
+func shouldRetry(err error) bool {
+	return !isError(err, errBadCategory) && !isError(err, errUnknownID) && !isError(err, errCircuitOpen)
+}
+
+// retriesStatus returns false when the providers answered with a status that
+// Cat.RetryableStatusCodes doesn't ask again, aggregated failures are asked
+// again when any of them would be
+func retriesStatus(config plugins.Cat, err error) bool {
+	var agg errorutil.Aggregate
+	if errors.As(err, &agg) {
+		for _, e := range agg.Errors() {
+			if retriesStatus(config, e) {
+				return true
+			}
+		}
+		return false
+	}
+	var statusErr *imagefetch.StatusError
+	if errors.As(err, &statusErr) {
+		return config.RetriesStatus(statusErr.StatusCode)
+	}
+	var limited *imagefetch.RateLimitedError
+	if errors.As(err, &limited) {
+		return config.RetriesStatus(http.StatusTooManyRequests)
+	}
+	return true
+}
+
+func retryableStatusHelp(codes []int) string {
+	if len(codes) == 0 {
+		return "429, 5xx"
+	}
+	help := make([]string, 0, len(codes))
+	for _, code := range codes {
+		help = append(help, strconv.Itoa(code))
+	}
+	return strings.Join(help, ", ")
+}
+
+// failureMessage explains why no cat could be posted, in the configured
+// messages when there are some
+func failureMessage(err error, category string, messages plugins.CatMessages) string {
+	switch {
+	case isError(err, errUnknownID):
+		id, _ := catID(category)
+		return fmt.Sprintf(unknownIDMessage, id)
+	case isError(err, errBadCategory):
+		return message(messages.BadCategory, badCategoryMessage)
+	case isError(err, errTransient):
+		return message(messages.Down, downMessage)
+	case isError(err, errNoCats):
+		return message(messages.NotFound, noCatsMessage)
+	case isError(err, errTooBig), isError(err, errInvalid):
+		return noSuitableCatMessage
+	case category != "":
+		return message(messages.BadCategory, badCategoryMessage)
+	default:
+		return message(messages.Down, downMessage)
+	}
+}
+
+// message returns the configured message, or the default when it is blank
+func message(configured, def string) string {
+	if strings.TrimSpace(configured) == "" {
+		return def
+	}
+	return configured
+}
+
+// retryAfter returns the longest delay requested by a rate limiting provider
+func retryAfter(err error) (time.Duration, bool) {
+	var rl *imagefetch.RateLimitedError
+	if errors.As(err, &rl) {
+		return rl.RetryAfter, true
+	}
+	var agg errorutil.Aggregate
+	if !errors.As(err, &agg) {
+		return 0, false
+	}
+	var longest time.Duration
+	limited := false
+	for _, e := range agg.Errors() {
+		if wait, ok := retryAfter(e); ok {
+			limited = true
+			if wait > longest {
+				longest = wait
+			}
+		}
+	}
+	return longest, limited
+}
+
+// deletePreviousCats deletes the cat comments the bot has left on the issue or PR
+func deletePreviousCats(spc SCMProviderClient, org, repo string, number int, pr bool) error {
+	botName, err := spc.BotName()
+	if err != nil {
+		return err
+	}
+	var comments []*scm.Comment
+	if pr {
+		comments, err = spc.ListPullRequestComments(org, repo, number)
+	} else {
+		comments, err = spc.ListIssueComments(org, repo, number)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list comments: %w", err)
+	}
+	var errs []error
+	for _, comment := range comments {
+		if comment.Author.Login != botName || !strings.Contains(comment.Body, catMarker) {
+			continue
+		}
+		if err := spc.DeleteComment(org, repo, number, comment.ID, pr); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete comment %d: %w", comment.ID, err))
+		}
+	}
+	return errorutil.NewAggregate(errs...)
+}
+
+// healthProvider checks that the cat api can be reached, at most once per interval
+func healthProvider(config *plugins.Configuration) error {
+	meow.configure(config.Cat, logrus.WithField("plugin", pluginName))
+	if err := health.check(meow, config.Cat.HealthCheckIntervalDuration); err != nil {
+		return fmt.Errorf("%w (%s)", err, meow.status())
+	}
+	return nil
+}
+
+// prober checks that cats can be fetched without posting one
+type prober interface {
+	probe() error
+}
+
+// healthCache remembers the result of the last probe so that health checks
+// don't spam the api.
+type healthCache struct {
+	lock    sync.Mutex
+	checked time.Time
+	err     error
+}
+
+func (h *healthCache) check(p prober, interval time.Duration) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	if !h.checked.IsZero() && pluginClock.Since(h.checked) < interval {
+		return h.err
+	}
+	h.err = p.probe()
+	h.checked = pluginClock.Now()
+	return h.err
+}
+
+// parseArg splits a gif flag and a count of cats out of the command argument,
+// leaving the category or breed. The meowvie alias always asks for a gif.
+func parseArg(name, arg string) (string, bool, int) {
+	movieCat := name == "meowvie"
+	count := 1
+	var rest []string
+	for _, field := range strings.Fields(arg) {
+		if n, err := strconv.Atoi(field); err == nil {
+			count = n
+			continue
+		}
+		lower := strings.ToLower(field)
+		switch {
+		case lower == "gif" || lower == "--gif":
+			movieCat = true
+		case isBigFlag(lower):
+			// read by bigOverride
+		case isFreshFlag(lower):
+			// read by freshOverride
+		case strings.HasPrefix(lower, "breed=") || strings.HasPrefix(lower, "count=") || strings.HasPrefix(lower, idPrefix):
+			// read from the named captures by parseMatch
+		default:
+			rest = append(rest, field)
+		}
+	}
+	return strings.Join(rest, " "), movieCat, clampCount(count)
+}
+
+// parseMatch parses the command argument, a `breed=` or `count=` capture
+// takes precedence over the plain words and an `id=` capture over both.
+func parseMatch(match plugins.CommandMatch) (string, bool, int) {
+	category, movieCat, count := parseArg(match.Name, match.Arg)
+	if breed := match.Captures["breed"]; breed != "" {
+		category = breed
+	}
+	if id := match.Captures["id"]; id != "" {
+		category = idPrefix + id
+	}
+	if n, err := strconv.Atoi(match.Captures["count"]); err == nil {
+		count = clampCount(n)
+	}
+	return category, movieCat, count
+}
+
+func isBigFlag(field string) bool {
+	field = strings.ToLower(field)
+	return field == "big" || field == "--big"
+}
+
+// bigOverride raises the image size limit for `/meow big` when the
+// configuration allows it, the override is ignored otherwise.
+func bigOverride(config plugins.Cat, match plugins.CommandMatch, log *logrus.Entry) plugins.Cat {
+	for _, field := range strings.Fields(match.Arg) {
+		if !isBigFlag(field) {
+			continue
+		}
+		if !config.AllowBigOverride {
+			log.Info("Ignoring the size override which is not allowed")
+			return config
+		}
+		config.MaxImageSizeBytes = config.BigImageSizeLimit()
+		return config
+	}
+	return config
+}
+
+// isGrumpy returns true if the category is one of the grumpy keywords, unless
+// the grumpy cat is disabled
+func isGrumpy(config plugins.Cat, category string) bool {
+	if config.DisableGrumpy {
+		return false
+	}
+	return grumpyMatcher(config).MatchString(category)
+}
+
+// looseGrumpyKeywords match the default keywords as a word of the argument
+var looseGrumpyKeywords = regexp.MustCompile(`(?i)(?:^|[^\pL\pN])(no|grumpy)(?:[^\pL\pN]|$)`)
+
+// grumpyMatcher returns the configured grumpy keywords, or the default ones
+// matched as strictly as Cat.GrumpyStrict asks for
+func grumpyMatcher(config plugins.Cat) *regexp.Regexp {
+	if config.GrumpyKeywordsRe != nil {
+		return config.GrumpyKeywordsRe
+	}
+	if !config.StrictGrumpy() {
+		return looseGrumpyKeywords
+	}
+	return grumpyKeywords
+}
+
+// normalizeCategory lowercases the category and collapses its whitespace, it
+// returns false for categories no provider could know so that they are turned
+// down without a request. Grumpy keywords are always accepted as they are and
+// synonyms are replaced with their category first.
+func normalizeCategory(config plugins.Cat, category string) (string, bool) {
+	if synonym, ok := config.CategorySynonym(category); ok {
+		category = synonym
+	}
+	if isGrumpy(config, category) {
+		return category, true
+	}
+	category = strings.ToLower(strings.Join(strings.Fields(category), " "))
+	if category == "" {
+		return "", true
+	}
+	return category, len(category) <= maxCategoryLength && validCategory.MatchString(category)
+}
+
+// pickCategory picks one of the categories at random in proportion to their
+// weights, random returns a number in [0, 1) and defaults to math/rand. It
+// returns no category when there are none to pick from.
+func pickCategory(categories []plugins.WeightedCategory, random func() float64) string {
+	total := 0
+	for _, category := range categories {
+		if category.Weight > 0 {
+			total += category.Weight
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+	if random == nil {
+		random = rand.Float64
+	}
+	n := int(random() * float64(total))
+	for _, category := range categories {
+		if category.Weight <= 0 {
+			continue
+		}
+		if n < category.Weight {
+			return category.Name
+		}
+		n -= category.Weight
+	}
+	return categories[len(categories)-1].Name
+}
+
+// isSafeCategory returns true if the category is one of the safe categories
+func isSafeCategory(category string) bool {
+	for _, safe := range safeCategories {
+		if strings.EqualFold(safe, category) {
+			return true
+		}
+	}
+	return false
+}
+
+// categoryError is a category that can't be asked for here, its reply tells
+// the user why
+type categoryError struct {
+	category string
+	reason   string
+	reply    string
+}
+
+func (e *categoryError) Error() string {
+	return fmt.Sprintf("%v %q: %s", errBadCategory, e.category, e.reason)
+}
+
+func (e *categoryError) Unwrap() error {
+	return errBadCategory
+}
+
+// checkCategory returns the category normalized, or an id as is, and a
+// *categoryError when it is invalid, unsafe in safe mode or not allowed.
+func checkCategory(config plugins.Cat, category string) (string, error) {
+	// ids are case sensitive and name an image rather than a category
+	id, byID := catID(category)
+	valid := true
+	if !byID {
+		category, valid = normalizeCategory(config, category)
+	}
+	safe := fmt.Sprintf("Sorry, only safe categories can be asked for here, try one of: %s.", strings.Join(safeCategories, ", "))
+	switch {
+	case !valid:
+		return category, &categoryError{category: category, reason: "not a valid category", reply: message(config.Messages.BadCategory, badCategoryMessage)}
+	case byID && config.SafeMode:
+		return category, &categoryError{category: id, reason: "ids are not allowed in safe mode", reply: safe}
+	case config.SafeMode && category != "" && !isSafeCategory(category) && !isGrumpy(config, category):
+		return category, &categoryError{category: category, reason: "not a safe category", reply: safe}
+	case !byID && !config.CategoryAllowed(category):
+		return category, &categoryError{category: category, reason: "not an allowed category", reply: fmt.Sprintf("Sorry, the %q category is not allowed here, try one of: %s.", category, strings.Join(config.AllowedCategories, ", "))}
+	}
+	return category, nil
+}
+
+func clampCount(count int) int {
+	if count < 1 {
+		return 1
+	}
+	if count > maxCats {
+		return maxCats
+	}
+	return count
+}
+
+func handleGenericComment(match plugins.CommandMatch, pc plugins.Agent, e scmprovider.GenericCommentEvent) error {
+	config, enabled := pc.PluginConfig.CatFor(e.Repo.Namespace, e.Repo.Name)
+	if !enabled {
+		return nil
+	}
+	ctx := pc.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	log := pc.Logger.WithField("command", match.Name)
+	if selfTriggered(pc.SCMProviderClient, log, &e) {
+		log.Debug("Ignoring a cat command of the bot itself")
+		return nil
+	}
+	if rejected, err := rejectNonMember(config, pc.PluginConfig.FormatResponseRaw, pc.SCMProviderClient, log, &e, replyTarget(&e)); rejected || err != nil {
+		return err
+	}
+	// the subcommands ask the clowder too, e.g. for the categories, so it is
+	// configured before any of them
+	var secrets secretReader
+	var configMaps corev1.ConfigMapsGetter
+	if pc.KubernetesClient != nil {
+		secrets = kubeSecretReader{client: pc.KubernetesClient.CoreV1()}
+		configMaps = pc.KubernetesClient.CoreV1()
+	}
+	meow.configure(config, pc.Logger)
+	meow.setKey(config.KeyPath, config.KeySecret, config.KeyReloadIntervalDuration, secrets, pc.Logger)
+	configured := func() {}
+	store := defaultsStore(config, configMaps, log)
+	if isCategoriesCommand(match.Arg) {
+		return handleCategories(ctx, config, pc.PluginConfig.FormatResponseRaw, pc.SCMProviderClient, log, &e, meow)
+	}
+	if isUndoCommand(match.Arg) {
+		return handleUndo(pc.PluginConfig.FormatResponseRaw, pc.SCMProviderClient, log, &e)
+	}
+	if config.Leaderboard && isLeaderboardCommand(match.Arg) {
+		return handleLeaderboard(pc.PluginConfig.FormatResponseRaw, pc.SCMProviderClient, log, &e, board)
+	}
+	if category, ok := parseSetDefault(match.Arg); ok {
+		return handleSetDefault(config, pc.PluginConfig.FormatResponseRaw, pc.SCMProviderClient, log, &e, store, category)
+	}
+	if arg, ok := parseDebug(match.Arg); config.DebugCommand && ok {
+		debug := plugins.CommandMatch{Name: match.Name, Arg: arg, Captures: match.Captures}
+		return handleDebug(ctx, config, pc.PluginConfig.FormatResponseRaw, pc.SCMProviderClient, log, &e, meow, store, debug, configured)
+	}
+	category, movieCat, count := parseMatch(match)
+	if category == "" {
+		category = defaultCategory(store, log, &e)
+	}
+	return handle(
+		freshOverride(ctx, match),
+		bigOverride(config, match, log),
+		pc.PluginConfig.FormatResponseRaw,
+		movieCat,
+		category,
+		count,
+		pc.SCMProviderClient,
+		log,
+		&e,
+		meow,
+		recent,
+		configured,
+	)
+}
+
+// selfTriggered returns true for the comments of the bot itself, which never
+// summon a cat so that the bot can't keep replying to its own replies
+func selfTriggered(spc SCMProviderClient, log *logrus.Entry, e *scmprovider.GenericCommentEvent) bool {
+	if e.Author.Login == "" {
+		return false
+	}
+	botName, err := spc.BotName()
+	if err != nil {
+		log.WithError(err).Warn("Failed to get the bot name, not checking whether the bot asked for the cat")
+		return false
+	}
+	return strings.EqualFold(botName, e.Author.Login)
+}
+
+// danglingMention is what is left of a mention of no one, e.g. the `@: ` of
+// plugins.FormatResponse for an empty login
+var danglingMention = regexp.MustCompile(`(^|\s)@(?:[:,][ \t]*|[ \t]+|$)`)
+
+// withoutEmptyMention drops the mention of the formatted replies to events
+// without an author, rather than leaving a dangling @
+func withoutEmptyMention(format plugins.ResponseFormatter) plugins.ResponseFormatter {
+	return func(body, bodyURL, login, reply string) string {
+		formatted := format(body, bodyURL, login, reply)
+		if strings.TrimSpace(login) != "" {
+			return formatted
+		}
+		return danglingMention.ReplaceAllString(formatted, "$1")
+	}
+}
+
+// isMember returns true if the user is a member of the org or a collaborator on the repo
+func isMember(spc SCMProviderClient, org, repo, user string) (bool, error) {
+	member, err := spc.IsMember(org, user)
+	if err != nil {
+		return false, fmt.Errorf("error in IsMember(%s): %v", org, err)
+	}
+	if member {
+		return true, nil
+	}
+	collaborator, err := spc.IsCollaborator(org, repo, user)
+	if err != nil {
+		return false, fmt.Errorf("error in IsCollaborator: %v", err)
+	}
+	return collaborator, nil
+}
+
+// rejectNonMember replies to the command of a user who is neither a member nor
+// a collaborator when Cat.RequireMember is set, returning true when it did.
+func rejectNonMember(config plugins.Cat, format plugins.ResponseFormatter, spc SCMProviderClient, log *logrus.Entry, e *scmprovider.GenericCommentEvent, to Target) (bool, error) {
+	if !config.RequireMember {
+		return false, nil
+	}
+	org := e.Repo.Namespace
+	member, err := isMember(spc, org, e.Repo.Name, e.Author.Login)
+	if err != nil {
+		return false, err
+	}
+	if member {
+		return false, nil
+	}
+	if format == nil {
+		format = plugins.FormatResponseRaw
+	}
+	format = withoutEmptyMention(format)
+	log.Infof("Ignoring cat request from %s who is not a member of %s", e.Author.Login, org)
+	return true, spc.CreateCommentReply(to.Org, to.Repo, to.Number, to.IsPR, to.ThreadID, format(e.Body, e.Link, spc.QuoteAuthorForComment(e.AuthorMention()), notMemberMessage))
+}
+
+// acknowledge reacts to the command as finding a cat can take a while, users
+// would otherwise repeat the command thinking it failed.
+func acknowledge(config plugins.Cat, spc SCMProviderClient, log *logrus.Entry, e *scmprovider.GenericCommentEvent) {
+	react(spc, log, e, config.AcknowledgeReaction(), "acknowledge the cat request")
+}
+
+// reactFailure reacts to the command when no cat could be found, so that the
+// failure shows at a glance and the failure message can be minimized.
+func reactFailure(config plugins.Cat, spc SCMProviderClient, log *logrus.Entry, e *scmprovider.GenericCommentEvent) {
+	react(spc, log, e, config.FailureReaction, "mark the failed cat request")
+}
+
+// catCooldown is the Cat.Cooldown of the repo, the subcommands don't cool down
+func catCooldown(match plugins.CommandMatch, pc plugins.Agent, e scmprovider.GenericCommentEvent) time.Duration {
+	config, enabled := pc.PluginConfig.CatFor(e.Repo.Namespace, e.Repo.Name)
+	if !enabled || isSubcommand(config, match.Arg) {
+		return 0
+	}
+	return config.CooldownDuration
+}
+
+// isSubcommand returns true when the argument is one of the subcommands
+// enabled in the repo, e.g. `/meow categories`, rather than a cat request.
+func isSubcommand(config plugins.Cat, arg string) bool {
+	_, setDefault := parseSetDefault(arg)
+	_, debug := parseDebug(arg)
+	return isCategoriesCommand(arg) ||
+		isUndoCommand(arg) ||
+		(config.Leaderboard && isLeaderboardCommand(arg)) ||
+		setDefault ||
+		(config.DebugCommand && debug)
+}
+
+// handleCooldown handles a cat command sent again within the cooldown, see
+// reactCooldown.
+func handleCooldown(match plugins.CommandMatch, pc plugins.Agent, e scmprovider.GenericCommentEvent) error {
+	config, enabled := pc.PluginConfig.CatFor(e.Repo.Namespace, e.Repo.Name)
+	if !enabled {
+		return nil
+	}
+	log := pc.Logger.WithField("command", match.Name)
+	if selfTriggered(pc.SCMProviderClient, log, &e) {
+		return nil
+	}
+	reactCooldown(config, pc.SCMProviderClient, log, &e)
+	return nil
+}
+
+// reactCooldown adds Cat.CooldownReaction to the command comment rather than
+// posting another cat.
+func reactCooldown(config plugins.Cat, spc SCMProviderClient, log *logrus.Entry, e *scmprovider.GenericCommentEvent) {
+	if config.CooldownReaction == "" {
+		return
+	}
+	react(spc, log, e, config.CooldownReaction, "point to the cat just posted")
+}
+
+// react adds the reaction to the command comment, what describes it in the logs
+func react(spc SCMProviderClient, log *logrus.Entry, e *scmprovider.GenericCommentEvent, reaction, what string) {
+	if e.CommentID == 0 || reaction == "" {
+		return
+	}
+	err := spc.CreateCommentReaction(e.Repo.Namespace, e.Repo.Name, e.Number, e.CommentID, e.IsPR, reaction)
+	switch {
+	case errors.Is(err, scm.ErrNotSupported):
+		log.WithError(err).Debugf("Reactions are not supported, could not %s", what)
+	case err != nil:
+		log.WithError(err).Warnf("Failed to %s", what)
+	}
+}
+
+// grumpyReacted returns true if the command comment has a thumbs down reaction
+func grumpyReacted(spc SCMProviderClient, log *logrus.Entry, e *scmprovider.GenericCommentEvent) bool {
+	if e.CommentID == 0 {
+		return false
+	}
+	reactions, err := spc.ListCommentReactions(e.Repo.Namespace, e.Repo.Name, e.Number, e.CommentID, e.IsPR)
+	switch {
+	case errors.Is(err, scm.ErrNotSupported):
+		log.WithError(err).Debug("Reactions are not supported, not looking for a thumbs down")
+		return false
+	case err != nil:
+		log.WithError(err).Warn("Failed to list the reactions on the cat request")
+		return false
+	}
+	for _, reaction := range reactions {
+		if reaction == grumpyReaction {
+			return true
+		}
+	}
+	return false
+}
+
+// imageDownloader can download the cats it finds
+type imageDownloader interface {
+	Download(ctx context.Context, image string, maxSize int) ([]byte, error)
+}
+
+// Download returns the content of the image, no bigger than maxSize bytes
+func (c *realClowder) Download(ctx context.Context, image string, maxSize int) ([]byte, error) {
+	return c.fetcher(maxSize).Download(ctx, image)
+}
+
+// uploadImages uploads the images of the markdown to the provider and returns
+// the markdown linking to the uploads instead. Images that can't be uploaded
+// are still linked where they were found.
+func uploadImages(ctx context.Context, spc SCMProviderClient, log *logrus.Entry, org, repo, md string, c Clowder, maxSize int) string {
+	d, ok := c.(imageDownloader)
+	if !ok {
+		log.Warn("Can't download the cats to upload them, linking them instead")
+		return md
+	}
+	for _, image := range imageURLs(md) {
+		content, err := d.Download(ctx, image, maxSize)
+		if err != nil {
+			log.WithError(err).Warnf("Failed to download %s, linking it instead", image)
+			continue
+		}
+		hosted, err := spc.UploadFile(org, repo, imageName(image), content)
+		if errors.Is(err, scm.ErrNotSupported) {
+			log.WithError(err).Warn("Uploads are not supported, linking the cats instead")
+			return md
+		}
+		if err != nil {
+			log.WithError(err).Warnf("Failed to upload %s, linking it instead", image)
+			continue
+		}
+		md = strings.ReplaceAll(md, "("+image+")", "("+hosted+")")
+		md = strings.ReplaceAll(md, `src="`+html.EscapeString(image)+`"`, `src="`+html.EscapeString(hosted)+`"`)
+	}
+	return md
+}
+
+// imageName is the file name of the image url
+func imageName(image string) string {
+	u, err := url.Parse(image)
+	if err != nil {
+		return "cat"
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return "cat"
+	}
+	return name
+}
+
+// retryComment creates the comment, trying again with the same backoff as the
+// cat requests when the provider fails e.g. with a 5xx.
+func retryComment(ctx context.Context, config plugins.Cat, log *logrus.Entry, create func() error) error {
+	attempts := config.Attempts()
+	backoff := config.Backoff()
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if serr := sleep(ctx, backoff.Delay(i)); serr != nil {
+				return fmt.Errorf("gave up posting the cat: %v: %w", serr, err)
+			}
+		}
+		if err = create(); err == nil {
+			return nil
+		}
+		if errors.Is(err, scm.ErrNotSupported) {
+			break
+		}
+		log.WithError(err).Warnf("Failed to post the cat (attempt %d of %d)", i+1, attempts)
+	}
+	return fmt.Errorf("could not post the cat: %w", err)
+}
+
+// sleep waits for the delay, returning early with an error when the context is done
+func sleep(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := pluginClock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
+
+// Handle responds to the /meow command match with cats from the clowder, it
+// lets tests drive the plugin with fakes such as the ones in the fake package.
+func Handle(ctx context.Context, config plugins.Cat, match plugins.CommandMatch, spc SCMProviderClient, log *logrus.Entry, e *scmprovider.GenericCommentEvent, c Clowder) error {
+	return HandleTo(ctx, config, match, spc, log, e, c, replyTarget(e))
+}
+
+// HandleTo is Handle posting the cats and replies to the target, e.g. a
+// tracking issue, rather than where the command was typed.
+func HandleTo(ctx context.Context, config plugins.Cat, match plugins.CommandMatch, spc SCMProviderClient, log *logrus.Entry, e *scmprovider.GenericCommentEvent, c Clowder, to Target) error {
+	log = log.WithField("command", match.Name)
+	if selfTriggered(spc, log, e) {
+		log.Debug("Ignoring a cat command of the bot itself")
+		return nil
+	}
+	if rejected, err := rejectNonMember(config, plugins.FormatResponseRaw, spc, log, e, to); rejected || err != nil {
+		return err
+	}
+	category, movieCat, count := parseMatch(match)
+	return handleTo(freshOverride(ctx, match), bigOverride(config, match, log), plugins.FormatResponseRaw, movieCat, category, count, spc, log, e, c, nil, func() {}, to)
+}
+
+func handle(ctx context.Context, config plugins.Cat, format plugins.ResponseFormatter, movieCat bool, category string, count int, spc SCMProviderClient, log *logrus.Entry, e *scmprovider.GenericCommentEvent, c Clowder, recent *recentCats, setKey func()) error {
+	return handleTo(ctx, config, format, movieCat, category, count, spc, log, e, c, recent, setKey, replyTarget(e))
+}
+
+// handleTo is handle commenting on the target rather than in reply to the
+// command, the author of the command is still the one checked.
+func handleTo(ctx context.Context, config plugins.Cat, format plugins.ResponseFormatter, movieCat bool, category string, count int, spc SCMProviderClient, log *logrus.Entry, e *scmprovider.GenericCommentEvent, c Clowder, recent *recentCats, setKey func(), to Target) error {
+	org := e.Repo.Namespace
+	repo := e.Repo.Name
+	number := e.Number
+	issue := to.String()
+	if format == nil {
+		format = plugins.FormatResponseRaw
+	}
+	format = withoutEmptyMention(format)
+	config = config.RepliesFor(to.IsPR)
+	if category == "" {
+		category = pickCategory(config.DefaultCategories, nil)
+	}
+	category, checkErr := checkCategory(config, category)
+	log = log.WithFields(logrus.Fields{
+		scmprovider.OrgLogField:  org,
+		scmprovider.RepoLogField: repo,
+		scmprovider.PrLogField:   number,
+		"category":               category,
+		"target":                 issue,
+	})
+
+	var bad *categoryError
+	if errors.As(checkErr, &bad) {
+		log.Infof("Ignoring cat request: %v", checkErr)
+		return spc.CreateCommentReply(to.Org, to.Repo, to.Number, to.IsPR, to.ThreadID, format(e.Body, e.Link, spc.QuoteAuthorForComment(e.AuthorMention()), bad.reply))
+	}
+
+	// Now that we know this is a relevant event we can set the key.
+	setKey()
+	acknowledge(config, spc, log, e)
+
+	fetches.configure(config.MaxConcurrentFetches, config.FetchQueueWaitDuration)
+	release, err := fetches.acquire(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		log.WithError(err).Warn("Too many cats are being looked for, asking to try again")
+		reactFailure(config, spc, log, e)
+		return spc.CreateCommentReply(to.Org, to.Repo, to.Number, to.IsPR, to.ThreadID, format(e.Body, e.Link, spc.QuoteAuthorForComment(e.AuthorMention()), message(config.Messages.Busy, busyMessage)))
+	}
+	defer release()
+
+	// the budget only bounds the search, the cat or the fallback is still posted
+	search, cancel := searchBudget(ctx, config)
+	defer cancel()
+
+	postCat := func(resp string) error {
+		if config.ReplacePrevious {
+			if err := deletePreviousCats(spc, to.Org, to.Repo, to.Number, to.IsPR); err != nil {
+				log.WithError(err).Warn("Failed to delete the previous cat")
+			}
+		}
+		body := resp
+		if config.UploadImages {
+			body = uploadImages(ctx, spc, log, to.Org, to.Repo, resp, c, config.MaxImageSizeBytes)
+		}
+		body = withFact(ctx, config, c, log, body)
+		render := func(body string) string {
+			body = templated(config.ReplyTmpl, log, body, e.Author.Login)
+			if config.Collapsible {
+				body = collapsed(body)
+			}
+			return format(e.Body, e.Link, spc.QuoteAuthorForComment(e.AuthorMention()), body) + summonedBy(e.Author.Login) + catMarker
+		}
+		comment, fits := fitComment(body, config.CommentLengthLimit(), render)
+		if !fits {
+			log.Warnf("The cat is still longer than the %d bytes of a comment, posting it anyway", config.CommentLengthLimit())
+		}
+		if err := tracedComment(ctx, to, func() error {
+			return retryComment(ctx, config, log, func() error {
+				return spc.CreateCommentReply(to.Org, to.Repo, to.Number, to.IsPR, to.ThreadID, comment)
+			})
+		}); err != nil {
+			return err
+		}
+		recent.add(issue, imageURLs(resp)...)
+		if config.Leaderboard {
+			countCat(board, log, e)
+		}
+		log.WithField("image", strings.Join(imageURLs(resp), ",")).Info("Posted a cat")
+		return nil
+	}
+
+	if config.GrumpyReaction && !config.DisableGrumpy && grumpyReacted(spc, log, e) {
+		if g, ok := c.(grumpyClowder); ok {
+			resp, err := g.readGrumpyCat(search, config.MaxImageSizeBytes)
+			if err == nil {
+				return postCat(resp)
+			}
+			log.WithError(err).Warn("Failed to get the grumpy cat, looking for another cat")
+		}
+	}
+
+	resp, lastErr := findCat(ctx, search, config, c, category, movieCat, count, log, recent, issue)
+	if lastErr == nil {
+		return postCat(resp)
+	}
+	if ctx.Err() != nil {
+		return lastErr
+	}
+
+	reactFailure(config, spc, log, e)
+	msg := failureMessage(lastErr, category, config.Messages)
+	if err := spc.CreateCommentReply(to.Org, to.Repo, to.Number, to.IsPR, to.ThreadID, format(e.Body, e.Link, spc.QuoteAuthorForComment(e.AuthorMention()), msg)); err != nil {
 		log.WithError(err).Error("Failed to leave comment")
 	}
 
@@ -0,0 +1,137 @@
+package cat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x/lighthouse/pkg/plugins"
+	"github.com/jenkins-x/lighthouse/pkg/plugins/imagefetch"
+	"github.com/jenkins-x/lighthouse/pkg/scmprovider"
+	"github.com/sirupsen/logrus"
+)
+
+// categoriesTTL is how long the categories listed by thecatapi.com are reused for
+const categoriesTTL = time.Hour
+
+// categoryLister lists the categories that can be asked for
+type categoryLister interface {
+	listCategories(ctx context.Context) ([]string, error)
+}
+
+// categoryList caches the categories known to the provider
+type categoryList struct {
+	lock    sync.Mutex
+	names   []string
+	expires time.Time
+}
+
+type catCategory struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// isCategoriesCommand returns true for the arguments asking for the categories
+func isCategoriesCommand(arg string) bool {
+	arg = strings.ToLower(strings.TrimSpace(arg))
+	return arg == "categories" || arg == "help"
+}
+
+// listCategories returns the sorted categories known to thecatapi.com, they are
+// only asked for once per categoriesTTL. Safe mode only lists the safe categories.
+func (c *realClowder) listCategories(ctx context.Context) ([]string, error) {
+	c.lock.RLock()
+	safe := c.safeMode
+	categoriesURL := c.categoriesURL
+	uri := categoriesURL
+	if uri != "" && c.key != "" {
+		uri += "?api_key=" + url.QueryEscape(c.key)
+	}
+	c.lock.RUnlock()
+	if safe {
+		return safeCategories, nil
+	}
+	if c.isOffline() {
+		return nil, errOffline
+	}
+	if uri == "" {
+		return nil, fmt.Errorf("no categories url configured")
+	}
+
+	c.categories.lock.Lock()
+	defer c.categories.lock.Unlock()
+	if c.categories.names != nil && c.time().Before(c.categories.expires) {
+		return c.categories.names, nil
+	}
+	if err := c.limiter.take(ctx); err != nil {
+		return nil, err
+	}
+
+	req, err := c.fetcher(0).NewRequest(ctx, http.MethodGet, uri)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request for %s: %w", categoriesURL, err)
+	}
+	imagefetch.AcceptCompressed(req)
+	resp, err := c.httpClient().Do(req) // #nosec
+	if err != nil {
+		return nil, fmt.Errorf("could not read categories from %s: %w", categoriesURL, err)
+	}
+	defer resp.Body.Close()
+	if sc := resp.StatusCode; sc > 299 || sc < 200 {
+		return nil, fmt.Errorf("failing %d response from %s", sc, categoriesURL)
+	}
+	body, err := imagefetch.DecodedBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("could not read categories from %s: %w", categoriesURL, err)
+	}
+	defer body.Close()
+	var list []catCategory
+	if err := json.NewDecoder(body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("could not decode categories from %s: %w", categoriesURL, err)
+	}
+	names := make([]string, 0, len(list))
+	for _, cg := range list {
+		if cg.Name != "" {
+			names = append(names, strings.ToLower(cg.Name))
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no categories listed by %s", categoriesURL)
+	}
+	sort.Strings(names)
+	c.categories.names = names
+	c.categories.expires = c.time().Add(categoriesTTL)
+	return names, nil
+}
+
+// handleCategories replies with the categories that can be asked for, or the
+// link to the categories documentation when they can't be listed
+func handleCategories(ctx context.Context, config plugins.Cat, format plugins.ResponseFormatter, spc SCMProviderClient, log *logrus.Entry, e *scmprovider.GenericCommentEvent, l categoryLister) error {
+	org := e.Repo.Namespace
+	repo := e.Repo.Name
+	if format == nil {
+		format = plugins.FormatResponseRaw
+	}
+	msg := message(config.Messages.BadCategory, badCategoryMessage)
+	categories, err := l.listCategories(ctx)
+	if err != nil {
+		log.WithError(err).Warn("Failed to list the cat categories")
+	} else {
+		var allowed []string
+		for _, name := range categories {
+			if config.CategoryAllowed(name) {
+				allowed = append(allowed, name)
+			}
+		}
+		if len(allowed) > 0 {
+			msg = fmt.Sprintf("The cat categories are: %s.", strings.Join(allowed, ", "))
+		}
+	}
+	return spc.CreateCommentReply(org, repo, e.Number, e.IsPR, e.ThreadID, format(e.Body, e.Link, spc.QuoteAuthorForComment(e.AuthorMention()), msg))
+}
@@ -0,0 +1,100 @@
+package cat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/jenkins-x/lighthouse/pkg/plugins/imagefetch"
+)
+
+// idPrefix marks the category of a request for the image with a given id,
+// e.g. `/meow id=<catid>`
+const idPrefix = "id="
+
+// unknownIDMessage is the reply when there is no cat with the requested id
+const unknownIDMessage = "Could not find a cat with the id %q, the ids are the letters, digits, `-` and `_` of a thecatapi.com image."
+
+// validCatID matches the ids of the thecatapi.com images
+var validCatID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// catID returns the image id of a category asking for a specific image
+func catID(category string) (string, bool) {
+	if !strings.HasPrefix(category, idPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(category, idPrefix), true
+}
+
+// imageURL is the url of the image with the id on the configured api
+func (c *realClowder) imageURL(id string) string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.apiVersion == legacyAPIVersion {
+		uri := apiSearchURL(apiBase(c.apiURL), legacyAPIVersion) + "&image_id=" + url.QueryEscape(id)
+		if c.key != "" {
+			uri += "&api_key=" + url.QueryEscape(c.key)
+		}
+		return uri
+	}
+	uri := apiBase(c.apiURL) + "/v1/images/" + url.PathEscape(id)
+	if c.key != "" {
+		uri += "?api_key=" + url.QueryEscape(c.key)
+	}
+	return uri
+}
+
+// readCatByID returns the image with the id, it is checked as any other cat
+func (c *realClowder) readCatByID(ctx context.Context, id string, maxSize int) (catResults, error) {
+	if !validCatID.MatchString(id) {
+		return nil, fmt.Errorf("%w %q: not a valid id", errUnknownID, id)
+	}
+	if err := c.limiter.take(ctx); err != nil {
+		return nil, err
+	}
+	f := c.fetcher(maxSize)
+	start := c.time()
+	body, err := f.Get(ctx, c.imageURL(id))
+	apiLatency.Observe(c.time().Sub(start).Seconds())
+	var statusErr *imagefetch.StatusError
+	if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusBadRequest || statusErr.StatusCode == http.StatusNotFound) {
+		return nil, fmt.Errorf("%w %q: %v", errUnknownID, id, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cat catResult
+	if c.legacyAPI() {
+		cats, err := decodeLegacyCats(body)
+		if err != nil {
+			return nil, decodeError(fmt.Sprintf("response for the cat %q", id), body, err)
+		}
+		if len(cats) > 0 {
+			cat = cats[0]
+		}
+	} else if err := json.Unmarshal(body, &cat); err != nil {
+		return nil, decodeError(fmt.Sprintf("response for the cat %q", id), body, err)
+	}
+	if cat.Image == "" {
+		return nil, fmt.Errorf("%w %q: no image in response", errUnknownID, id)
+	}
+	if cat.Image, err = c.checkScheme(cat.Image); err != nil {
+		return nil, err
+	}
+	if err := c.checkHost(cat.Image); err != nil {
+		return nil, err
+	}
+	if err := c.checkDimensions(cat); err != nil {
+		return nil, err
+	}
+	if err := c.resolve(ctx, f, &cat); err != nil {
+		logTooBig(err)
+		return nil, err
+	}
+	return catResults{cat}, nil
+}
@@ -0,0 +1,17 @@
+package cat
+
+import (
+	"k8s.io/utils/clock"
+)
+
+// pluginClock tells the time of the plugin: the key reloads, caches, ttls,
+// breaker and waits. Tests swap it for a fake clock to step through them.
+var pluginClock clock.Clock = clock.RealClock{}
+
+// clockOr returns the clock, or the plugin's when it is nil
+func clockOr(c clock.PassiveClock) clock.PassiveClock {
+	if c == nil {
+		return pluginClock
+	}
+	return c
+}
@@ -0,0 +1,137 @@
+package cat
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jenkins-x/lighthouse/pkg/plugins"
+	"github.com/jenkins-x/lighthouse/pkg/scmprovider"
+	"github.com/sirupsen/logrus"
+)
+
+// debugCommand is the argument replying with the requests a /meow would make,
+// e.g. `/meow debug gif hats`
+const debugCommand = "debug"
+
+// redactedKey replaces the api key in the urls shown by /meow debug
+const redactedKey = "REDACTED"
+
+// debugRoles are the permissions letting a user see the requests of a /meow
+var debugRoles = []string{scmprovider.RoleAdmin, scmprovider.RoleMaintainer}
+
+// debugClowder can tell the requests it would make for a cat
+type debugClowder interface {
+	requestURLs(ctx context.Context, category string, movieCat bool, count int) []string
+}
+
+// parseDebug returns the argument of the /meow to debug, and whether the
+// argument asks for the debug output at all
+func parseDebug(arg string) (string, bool) {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], debugCommand) {
+		return "", false
+	}
+	return strings.Join(fields[1:], " "), true
+}
+
+// requestURLs returns the urls the providers would be asked for the cats with,
+// in the order they are tried when the weights don't pick it, with the key
+// redacted. An image url stands for the cats that aren't searched for.
+func (c *realClowder) requestURLs(ctx context.Context, category string, movieCat bool, count int) []string {
+	urls := c.requests(ctx, category, movieCat, count)
+	c.lock.RLock()
+	key := c.key
+	c.lock.RUnlock()
+	for i := range urls {
+		urls[i] = redactKey(urls[i], key)
+	}
+	return urls
+}
+
+func (c *realClowder) requests(ctx context.Context, category string, movieCat bool, count int) []string {
+	if c.isOffline() {
+		c.lock.RLock()
+		defer c.lock.RUnlock()
+		return []string{c.offlineURL + OfflineImagePath + offlineImage}
+	}
+	if grumpy, ok := c.grumpyImage(category); ok {
+		return []string{grumpy}
+	}
+	if id, ok := catID(category); ok {
+		return []string{c.imageURL(id)}
+	}
+	if category != "" {
+		if err := c.loadBreeds(ctx); err != nil {
+			logrus.WithField("plugin", pluginName).WithError(err).Warn("Failed to load cat breeds, treating argument as a category")
+		}
+	}
+	var urls []string
+	for _, provider := range c.providerURLs() {
+		urls = append(urls, c.providerURL(provider, category, movieCat, count))
+	}
+	return urls
+}
+
+// redactKey replaces the key in the url, escaped or not
+func redactKey(uri, key string) string {
+	if key == "" {
+		return uri
+	}
+	uri = strings.ReplaceAll(uri, url.QueryEscape(key), redactedKey)
+	return strings.ReplaceAll(uri, key, redactedKey)
+}
+
+// handleDebug replies with the requests the /meow of the match would make, when
+// asked by a maintainer of the repo, so that a category that doesn't work can
+// be looked into without the logs of the bot.
+func handleDebug(ctx context.Context, config plugins.Cat, format plugins.ResponseFormatter, spc SCMProviderClient, log *logrus.Entry, e *scmprovider.GenericCommentEvent, c debugClowder, store DefaultCategoryStore, match plugins.CommandMatch, setKey func()) error {
+	org := e.Repo.Namespace
+	repo := e.Repo.Name
+	if format == nil {
+		format = plugins.FormatResponseRaw
+	}
+	reply := func(msg string) error {
+		return spc.CreateCommentReply(org, repo, e.Number, e.IsPR, e.ThreadID, format(e.Body, e.Link, spc.QuoteAuthorForComment(e.AuthorMention()), msg))
+	}
+	maintainer, err := spc.HasPermission(org, repo, e.Author.Login, debugRoles...)
+	if err != nil {
+		return fmt.Errorf("error in HasPermission(%s/%s): %v", org, repo, err)
+	}
+	if !maintainer {
+		log.Infof("Ignoring the cat debug request from %s who doesn't maintain %s/%s", e.Author.Login, org, repo)
+		return reply("Sorry, only a maintainer can see the requests of the cat plugin.")
+	}
+
+	category, movieCat, count := parseMatch(match)
+	if category == "" {
+		category = defaultCategory(store, log, e)
+	}
+	if category == "" {
+		category = pickCategory(config.DefaultCategories, nil)
+	}
+	if _, byID := catID(category); !byID {
+		normalized, valid := normalizeCategory(config, category)
+		if !valid {
+			return reply(fmt.Sprintf("The category %q is not valid, no request would be made.", category))
+		}
+		category = normalized
+	}
+	setKey()
+	urls := c.requestURLs(ctx, category, movieCat, count)
+	log.WithField("category", category).Infof("Showing the cat requests to %s", e.Author.Login)
+	return reply(fmt.Sprintf("Asking for %d %s with the category %q would request:\n\n```\n%s\n```", count, catsNoun(count, movieCat), category, strings.Join(urls, "\n")))
+}
+
+// catsNoun names the cats asked for in the debug reply
+func catsNoun(count int, movieCat bool) string {
+	noun := "cat"
+	if movieCat {
+		noun = "gif"
+	}
+	if count != 1 {
+		noun += "s"
+	}
+	return noun
+}
@@ -0,0 +1,242 @@
+package cat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jenkins-x/lighthouse/pkg/plugins"
+	"github.com/jenkins-x/lighthouse/pkg/scmprovider"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// setDefaultCommand is the argument setting the category of a bare /meow, e.g.
+// `/meow set-default tabby`, without a category the default is cleared
+const setDefaultCommand = "set-default"
+
+// setDefaultRoles are the permissions letting a user set the default category
+var setDefaultRoles = []string{scmprovider.RoleAdmin, scmprovider.RoleMaintainer}
+
+// defaults keeps the categories set with /meow set-default, see SetDefaultCategoryStore
+var defaults DefaultCategoryStore = newMemoryDefaults()
+
+// DefaultCategoryStore keeps the category a bare /meow asks for in each repo
+type DefaultCategoryStore interface {
+	// Get returns the default category of the org/repo, empty when there is none
+	Get(repo string) (string, error)
+	// Set changes the default category of the org/repo, empty clears it
+	Set(repo, category string) error
+}
+
+// SetDefaultCategoryStore replaces the in-memory default categories, e.g. with
+// a store that survives restarts.
+func SetDefaultCategoryStore(store DefaultCategoryStore) {
+	defaults = store
+}
+
+// memoryDefaults is a DefaultCategoryStore that is lost on restart
+type memoryDefaults struct {
+	lock       sync.Mutex
+	categories map[string]string
+}
+
+func newMemoryDefaults() *memoryDefaults {
+	return &memoryDefaults{categories: map[string]string{}}
+}
+
+// Get returns the default category of the repo
+func (m *memoryDefaults) Get(repo string) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.categories[repo], nil
+}
+
+// Set changes the default category of the repo
+func (m *memoryDefaults) Set(repo, category string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if category == "" {
+		delete(m.categories, repo)
+		return nil
+	}
+	m.categories[repo] = category
+	return nil
+}
+
+// defaultsKey is the key of the ConfigMap holding the default categories, as
+// a json object of the org/repo to their category
+const defaultsKey = "defaults.json"
+
+// configMapDefaults is a DefaultCategoryStore kept in a ConfigMap, so that the
+// default categories survive restarts
+type configMapDefaults struct {
+	client    corev1.ConfigMapsGetter
+	namespace string
+	name      string
+}
+
+// newConfigMapDefaults stores the default categories in the namespace/name
+// ConfigMap, which is created when the first default is set
+func newConfigMapDefaults(client corev1.ConfigMapsGetter, ref string) (*configMapDefaults, error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid configmap reference %q, expected namespace/name", ref)
+	}
+	return &configMapDefaults{client: client, namespace: parts[0], name: parts[1]}, nil
+}
+
+// read returns the ConfigMap, nil when it doesn't exist yet, and its categories
+func (s *configMapDefaults) read(ctx context.Context) (*v1.ConfigMap, map[string]string, error) {
+	categories := map[string]string{}
+	cm, err := s.client.ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, categories, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if data := cm.Data[defaultsKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &categories); err != nil {
+			return nil, nil, fmt.Errorf("invalid %s in configmap %s/%s: %w", defaultsKey, s.namespace, s.name, err)
+		}
+	}
+	return cm, categories, nil
+}
+
+// Get returns the default category of the repo
+func (s *configMapDefaults) Get(repo string) (string, error) {
+	_, categories, err := s.read(context.TODO())
+	if err != nil {
+		return "", err
+	}
+	return categories[repo], nil
+}
+
+// Set changes the default category of the repo, trying again when the
+// ConfigMap was changed in the meantime
+func (s *configMapDefaults) Set(repo, category string) error {
+	ctx := context.TODO()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, categories, err := s.read(ctx)
+		if err != nil {
+			return err
+		}
+		if category == "" {
+			delete(categories, repo)
+		} else {
+			categories[repo] = category
+		}
+		data, err := json.Marshal(categories)
+		if err != nil {
+			return err
+		}
+		if cm == nil {
+			cm = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace, Name: s.name}}
+			cm.Data = map[string]string{defaultsKey: string(data)}
+			_, err = s.client.ConfigMaps(s.namespace).Create(ctx, cm, metav1.CreateOptions{})
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[defaultsKey] = string(data)
+		_, err = s.client.ConfigMaps(s.namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// defaultsStore returns the store of the default categories, the ConfigMap of
+// Cat.DefaultsConfigMap when there is one, the store of the plugin otherwise
+func defaultsStore(config plugins.Cat, client corev1.ConfigMapsGetter, log *logrus.Entry) DefaultCategoryStore {
+	if config.DefaultsConfigMap == "" {
+		return defaults
+	}
+	if client == nil {
+		log.Warn("No kubernetes client to keep the default cat categories in a configmap, keeping them in memory")
+		return defaults
+	}
+	store, err := newConfigMapDefaults(client, config.DefaultsConfigMap)
+	if err != nil {
+		log.WithError(err).Warn("Keeping the default cat categories in memory")
+		return defaults
+	}
+	return store
+}
+
+// parseSetDefault returns the category of an argument setting the default
+// category, and whether the argument sets it at all
+func parseSetDefault(arg string) (string, bool) {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], setDefaultCommand) {
+		return "", false
+	}
+	return strings.Join(fields[1:], " "), true
+}
+
+// defaultCategory returns the category set for a bare /meow in the repo of the
+// event, empty when there is none or it can't be read
+func defaultCategory(store DefaultCategoryStore, log *logrus.Entry, e *scmprovider.GenericCommentEvent) string {
+	if store == nil {
+		return ""
+	}
+	category, err := store.Get(e.Repo.Namespace + "/" + e.Repo.Name)
+	if err != nil {
+		log.WithError(err).Warn("Failed to read the default cat category")
+		return ""
+	}
+	return category
+}
+
+// handleSetDefault stores the category a bare /meow asks for in the repo, when
+// asked by a maintainer of the repo. The category has to be one that could be
+// asked for with /meow.
+func handleSetDefault(config plugins.Cat, format plugins.ResponseFormatter, spc SCMProviderClient, log *logrus.Entry, e *scmprovider.GenericCommentEvent, store DefaultCategoryStore, category string) error {
+	org := e.Repo.Namespace
+	repo := e.Repo.Name
+	if format == nil {
+		format = plugins.FormatResponseRaw
+	}
+	reply := func(msg string) error {
+		return spc.CreateCommentReply(org, repo, e.Number, e.IsPR, e.ThreadID, format(e.Body, e.Link, spc.QuoteAuthorForComment(e.AuthorMention()), msg))
+	}
+	maintainer, err := spc.HasPermission(org, repo, e.Author.Login, setDefaultRoles...)
+	if err != nil {
+		return fmt.Errorf("error in HasPermission(%s/%s): %v", org, repo, err)
+	}
+	if !maintainer {
+		log.Infof("Ignoring the default cat category from %s who doesn't maintain %s/%s", e.Author.Login, org, repo)
+		return reply("Sorry, only a maintainer can set the default cat category.")
+	}
+
+	full := org + "/" + repo
+	if category == "" {
+		if err := store.Set(full, ""); err != nil {
+			log.WithError(err).Warn("Failed to clear the default cat category")
+			return reply("Sorry, the default cat category can't be changed right now.")
+		}
+		log.Infof("Cleared the default cat category at the request of %s", e.Author.Login)
+		return reply(fmt.Sprintf("A bare `/meow` asks for any cat in %s again.", full))
+	}
+	if _, byID := catID(category); byID {
+		return reply("Sorry, the default cat category can't be a specific image.")
+	}
+	normalized, err := checkCategory(config, category)
+	var bad *categoryError
+	if errors.As(err, &bad) {
+		return reply(bad.reply)
+	}
+	if err := store.Set(full, normalized); err != nil {
+		log.WithError(err).Warn("Failed to set the default cat category")
+		return reply("Sorry, the default cat category can't be changed right now.")
+	}
+	log.WithField("category", normalized).Infof("Set the default cat category at the request of %s", e.Author.Login)
+	return reply(fmt.Sprintf("A bare `/meow` now asks for the %q category in %s.", normalized, full))
+}
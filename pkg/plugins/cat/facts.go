@@ -0,0 +1,109 @@
+package cat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/jenkins-x/lighthouse/pkg/plugins"
+	"github.com/sirupsen/logrus"
+)
+
+// maxFactLength is the longest fact added under the cats, longer ones are cut
+const maxFactLength = 280
+
+// bundledFacts are the facts added with Cat.IncludeFact when there is no
+// Cat.FactsURL, or when the clowder can't ask it
+var bundledFacts = []string{
+	"Cats sleep for around 13 to 16 hours a day.",
+	"A group of cats is called a clowder.",
+	"Cats have five toes on their front paws but only four on their back paws.",
+	"A cat's nose print is unique, much like a human fingerprint.",
+	"Cats can rotate their ears 180 degrees.",
+	"Adult cats mostly meow to talk to people rather than to other cats.",
+	"A cat can jump up to six times its own length.",
+	"Cats walk like camels and giraffes, moving both right feet and then both left feet.",
+	"Cats can't taste sweetness.",
+	"The oldest known pet cat was buried with its owner in Cyprus around 9,500 years ago.",
+	"A cat's purr vibrates at a frequency of 25 to 150 hertz.",
+	"Kittens are born with blue eyes, their adult colour comes in later.",
+}
+
+// factClowder can ask the facts api for a fact
+type factClowder interface {
+	readFact(ctx context.Context, config plugins.Cat, log *logrus.Entry) (string, error)
+}
+
+// readFact asks Cat.FactsURL for a fact with the timeout, proxy and user agent
+// of the cat requests, trying again with their backoff when it fails.
+func (c *realClowder) readFact(ctx context.Context, config plugins.Cat, log *logrus.Entry) (string, error) {
+	attempts := config.Attempts()
+	backoff := config.Backoff()
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if serr := sleep(ctx, backoff.Delay(i)); serr != nil {
+				return "", fmt.Errorf("gave up asking for a cat fact: %v: %w", serr, err)
+			}
+		}
+		var body []byte
+		body, err = c.fetcher(0).Get(ctx, config.FactsURL)
+		if err == nil {
+			return decodeFact(body)
+		}
+		if !shouldRetry(err) || !retriesStatus(config, err) {
+			break
+		}
+		log.WithError(err).Warnf("Failed to get a cat fact (attempt %d of %d)", i+1, attempts)
+	}
+	return "", err
+}
+
+// decodeFact reads the fact of a response of the facts api
+func decodeFact(body []byte) (string, error) {
+	var resp struct {
+		Fact string `json:"fact"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("%w in cat fact response: %v", errInvalid, err)
+	}
+	if strings.TrimSpace(resp.Fact) == "" {
+		return "", fmt.Errorf("%w: no fact in cat fact response", errInvalid)
+	}
+	return resp.Fact, nil
+}
+
+// withFact adds a cat fact under the markdown of the cats with
+// Cat.IncludeFact, the cats are returned as they are when there is no fact.
+func withFact(ctx context.Context, config plugins.Cat, c Clowder, log *logrus.Entry, md string) string {
+	if !config.IncludeFact {
+		return md
+	}
+	fact, err := pickFact(ctx, config, c, log)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get a cat fact, posting the cat without one")
+		return md
+	}
+	return md + "\n\n" + formatFact(fact)
+}
+
+// pickFact returns a fact from the facts api, or one of the bundled facts
+// when there is none or the clowder can't ask it
+func pickFact(ctx context.Context, config plugins.Cat, c Clowder, log *logrus.Entry) (string, error) {
+	if f, ok := c.(factClowder); ok && config.FactsURL != "" {
+		return f.readFact(ctx, config, log)
+	}
+	return bundledFacts[rand.Intn(len(bundledFacts))], nil
+}
+
+// formatFact puts the fact on a single line under a heading, cutting it short
+// when it is too long for a caption
+func formatFact(fact string) string {
+	fact = strings.Join(strings.Fields(fact), " ")
+	if runes := []rune(fact); len(runes) > maxFactLength {
+		fact = strings.TrimSpace(string(runes[:maxFactLength-1])) + "…"
+	}
+	return "**Cat fact:** " + fact
+}
@@ -0,0 +1,337 @@
+// Package fake provides a scriptable clowder, an scm client recording
+// comments and cat api servers for testing the cat plugin, see cat.Handle.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/lighthouse/pkg/plugins/imagefetch"
+)
+
+// Response is a scripted result of the clowder
+type Response struct {
+	// Image is the url of the cat image returned when there is no error
+	Image string
+	// Markdown is returned as is instead of the markdown of the image
+	Markdown string
+	// Err is returned instead of the image
+	Err error
+	// Delay is waited for before responding, the context being done first
+	// fails with its error
+	Delay time.Duration
+	// Do is called before responding, e.g. to cancel the context of the request
+	Do func()
+}
+
+// Image returns a response with the cat image
+func Image(image string) Response {
+	return Response{Image: image}
+}
+
+// Markdown returns a response with the markdown as is
+func Markdown(md string) Response {
+	return Response{Markdown: md}
+}
+
+// Error returns a response failing with the error
+func Error(err error) Response {
+	return Response{Err: err}
+}
+
+// Slow returns a response failing with the error after the delay
+func Slow(delay time.Duration, err error) Response {
+	return Response{Delay: delay, Err: err}
+}
+
+// Failing returns the responses failing with the error the given number of
+// times before the response, e.g. for a flaky provider
+func Failing(times int, err error, resp Response) []Response {
+	var responses []Response
+	for i := 0; i < times; i++ {
+		responses = append(responses, Error(err))
+	}
+	return append(responses, resp)
+}
+
+// TooBig returns a response failing as the image is over the size limit
+func TooBig(image string) Response {
+	return Response{Err: fmt.Errorf("%w: %s", imagefetch.ErrTooBig, image)}
+}
+
+// Call records the arguments the clowder was asked for a cat with
+type Call struct {
+	Category string
+	MovieCat bool
+	MaxSize  int
+	Count    int
+}
+
+// Clowder returns the scripted responses in turn, repeating the last one once
+// they run out.
+type Clowder struct {
+	Responses []Response
+	Calls     []Call
+	// Cycle starts over with the first response once they run out
+	Cycle bool
+	// Files are the contents of the images that can be downloaded, by url
+	Files map[string][]byte
+
+	lock sync.Mutex
+}
+
+// NewClowder creates a fake clowder returning the responses
+func NewClowder(responses ...Response) *Clowder {
+	return &Clowder{Responses: responses}
+}
+
+// ReadCat returns the markdown of the next scripted image or its error
+func (c *Clowder) ReadCat(ctx context.Context, category string, movieCat bool, maxSize, count int) (string, error) {
+	c.lock.Lock()
+	i := len(c.Calls)
+	c.Calls = append(c.Calls, Call{Category: category, MovieCat: movieCat, MaxSize: maxSize, Count: count})
+	if len(c.Responses) == 0 {
+		c.lock.Unlock()
+		return "", fmt.Errorf("%w: no scripted responses", imagefetch.ErrNoImages)
+	}
+	switch {
+	case c.Cycle:
+		i %= len(c.Responses)
+	case i >= len(c.Responses):
+		i = len(c.Responses) - 1
+	}
+	resp := c.Responses[i]
+	c.lock.Unlock()
+
+	if resp.Do != nil {
+		resp.Do()
+	}
+	if resp.Delay > 0 {
+		timer := time.NewTimer(resp.Delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-timer.C:
+		}
+	}
+	switch {
+	case resp.Err != nil:
+		return "", resp.Err
+	case resp.Markdown != "":
+		return resp.Markdown, nil
+	}
+	return fmt.Sprintf("![fake cat image](%s)", resp.Image), nil
+}
+
+// Download returns the content of the image from Files, failing as too big
+// past maxSize bytes when it is set
+func (c *Clowder) Download(ctx context.Context, image string, maxSize int) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	content, ok := c.Files[image]
+	if !ok {
+		return nil, fmt.Errorf("no fake file for %s", image)
+	}
+	if maxSize > 0 && len(content) > maxSize {
+		return nil, fmt.Errorf("%w: %s is %d bytes", imagefetch.ErrTooBig, image, len(content))
+	}
+	return content, nil
+}
+
+// Comment is a comment created through the fake scm client
+type Comment struct {
+	ID     int
+	Org    string
+	Repo   string
+	Number int
+	PR     bool
+	Body   string
+	// ThreadID is the discussion replied to, empty for top level comments
+	ThreadID string
+}
+
+// SCMClient records the comments created by the plugin
+type SCMClient struct {
+	Bot           string
+	Members       []string
+	Collaborators []string
+	Comments      []Comment
+	// Maintainers have all the permissions asked for by HasPermission
+	Maintainers []string
+	// Reactions are the reactions added, as org/repo#commentid:reaction
+	Reactions []string
+	// ReactionErr is returned when adding reactions, e.g. scm.ErrNotSupported
+	ReactionErr error
+	// Uploads are the files uploaded, by the url they are hosted at
+	Uploads map[string][]byte
+	// UploadErr is returned when uploading files, e.g. scm.ErrNotSupported
+	UploadErr error
+	// CommentErrs are returned in turn instead of creating the next comments,
+	// e.g. to have the provider fail a few times
+	CommentErrs []error
+
+	lock   sync.Mutex
+	nextID int
+}
+
+// NewSCMClient creates a fake scm client for the bot
+func NewSCMClient(bot string) *SCMClient {
+	return &SCMClient{Bot: bot}
+}
+
+// CreateComment records the comment unless there are CommentErrs left
+func (c *SCMClient) CreateComment(owner, repo string, number int, pr bool, comment string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.CommentErrs) > 0 {
+		err := c.CommentErrs[0]
+		c.CommentErrs = c.CommentErrs[1:]
+		return err
+	}
+	c.nextID++
+	c.Comments = append(c.Comments, Comment{ID: c.nextID, Org: owner, Repo: repo, Number: number, PR: pr, Body: comment})
+	return nil
+}
+
+// CreateCommentReply records the comment as a reply within the thread
+func (c *SCMClient) CreateCommentReply(owner, repo string, number int, pr bool, threadID, comment string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.CommentErrs) > 0 {
+		err := c.CommentErrs[0]
+		c.CommentErrs = c.CommentErrs[1:]
+		return err
+	}
+	c.nextID++
+	c.Comments = append(c.Comments, Comment{ID: c.nextID, Org: owner, Repo: repo, Number: number, PR: pr, Body: comment, ThreadID: threadID})
+	return nil
+}
+
+// DeleteComment removes the recorded comment
+func (c *SCMClient) DeleteComment(org, repo string, number, ID int, pr bool) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i, comment := range c.Comments {
+		if comment.ID == ID && comment.Org == org && comment.Repo == repo && comment.Number == number && comment.PR == pr {
+			c.Comments = append(c.Comments[:i], c.Comments[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("could not find comment %d on %s/%s#%d", ID, org, repo, number)
+}
+
+// ListIssueComments returns the comments recorded on the issue
+func (c *SCMClient) ListIssueComments(org, repo string, number int) ([]*scm.Comment, error) {
+	return c.list(org, repo, number, false), nil
+}
+
+// ListPullRequestComments returns the comments recorded on the pull request
+func (c *SCMClient) ListPullRequestComments(org, repo string, number int) ([]*scm.Comment, error) {
+	return c.list(org, repo, number, true), nil
+}
+
+func (c *SCMClient) list(org, repo string, number int, pr bool) []*scm.Comment {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var comments []*scm.Comment
+	for _, comment := range c.Comments {
+		if comment.Org == org && comment.Repo == repo && comment.Number == number && comment.PR == pr {
+			comments = append(comments, &scm.Comment{
+				ID:     comment.ID,
+				Body:   comment.Body,
+				Author: scm.User{Login: c.Bot},
+			})
+		}
+	}
+	return comments
+}
+
+// CreateCommentReaction records the reaction unless ReactionErr is set
+func (c *SCMClient) CreateCommentReaction(owner, repo string, number, id int, pr bool, reaction string) error {
+	if c.ReactionErr != nil {
+		return c.ReactionErr
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.Reactions = append(c.Reactions, fmt.Sprintf("%s/%s#%d:%s", owner, repo, id, reaction))
+	return nil
+}
+
+// ListCommentReactions returns the reactions recorded on the comment
+func (c *SCMClient) ListCommentReactions(owner, repo string, number, id int, pr bool) ([]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	prefix := fmt.Sprintf("%s/%s#%d:", owner, repo, id)
+	var reactions []string
+	for _, r := range c.Reactions {
+		if strings.HasPrefix(r, prefix) {
+			reactions = append(reactions, strings.TrimPrefix(r, prefix))
+		}
+	}
+	return reactions, nil
+}
+
+// UploadFile records the file and returns the url it would be hosted at
+func (c *SCMClient) UploadFile(owner, repo, name string, content []byte) (string, error) {
+	if c.UploadErr != nil {
+		return "", c.UploadErr
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.Uploads == nil {
+		c.Uploads = map[string][]byte{}
+	}
+	hosted := fmt.Sprintf("https://scm.example.com/%s/%s/uploads/%d/%s", owner, repo, len(c.Uploads)+1, name)
+	c.Uploads[hosted] = content
+	return hosted, nil
+}
+
+// BotName returns the login of the bot
+func (c *SCMClient) BotName() (string, error) {
+	return c.Bot, nil
+}
+
+// QuoteAuthorForComment returns the login unchanged
+func (c *SCMClient) QuoteAuthorForComment(author string) string {
+	return author
+}
+
+// IsCollaborator returns true for the configured collaborators
+func (c *SCMClient) IsCollaborator(org, repo, user string) (bool, error) {
+	return contains(c.Collaborators, user), nil
+}
+
+// IsMember returns true for the configured members
+func (c *SCMClient) IsMember(org, user string) (bool, error) {
+	return contains(c.Members, user), nil
+}
+
+// HasPermission returns true for the configured maintainers, whatever the roles
+func (c *SCMClient) HasPermission(org, repo, user string, roles ...string) (bool, error) {
+	return contains(c.Maintainers, user), nil
+}
+
+// Bodies returns the bodies of the recorded comments
+func (c *SCMClient) Bodies() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var bodies []string
+	for _, comment := range c.Comments {
+		bodies = append(bodies, comment.Body)
+	}
+	return bodies
+}
+
+func contains(logins []string, login string) bool {
+	for _, l := range logins {
+		if l == login {
+			return true
+		}
+	}
+	return false
+}
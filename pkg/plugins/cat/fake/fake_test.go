@@ -0,0 +1,316 @@
+package fake_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/lighthouse/pkg/plugins"
+	"github.com/jenkins-x/lighthouse/pkg/plugins/cat"
+	"github.com/jenkins-x/lighthouse/pkg/plugins/cat/fake"
+	"github.com/jenkins-x/lighthouse/pkg/plugins/imagefetch"
+	"github.com/jenkins-x/lighthouse/pkg/scmprovider"
+	"github.com/sirupsen/logrus"
+)
+
+// implements interfaces
+var _ cat.Clowder = &fake.Clowder{}
+var _ cat.SCMProviderClient = &fake.SCMClient{}
+
+func event(author string) *scmprovider.GenericCommentEvent {
+	return &scmprovider.GenericCommentEvent{
+		Action: scm.ActionCreate,
+		Body:   "/meow",
+		Number: 5,
+		Repo:   scm.Repository{Namespace: "org", Name: "repo"},
+		Author: scm.User{Login: author},
+	}
+}
+
+func TestClowderResponses(t *testing.T) {
+	c := fake.NewClowder(fake.Image("https://example.com/1.jpg"), fake.TooBig("https://example.com/big.jpg"))
+	first, err := c.ReadCat(context.Background(), "tabby", true, 100, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(first, "https://example.com/1.jpg") {
+		t.Errorf("expected the first image, got %q", first)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.ReadCat(context.Background(), "", false, 0, 1); !errors.Is(err, imagefetch.ErrTooBig) {
+			t.Errorf("expected the last response to repeat as too big, got %v", err)
+		}
+	}
+	if len(c.Calls) != 3 {
+		t.Fatalf("expected 3 recorded calls, got %d", len(c.Calls))
+	}
+	if expected := (fake.Call{Category: "tabby", MovieCat: true, MaxSize: 100, Count: 2}); c.Calls[0] != expected {
+		t.Errorf("expected call %+v, got %+v", expected, c.Calls[0])
+	}
+	if _, err := fake.NewClowder().ReadCat(context.Background(), "", false, 0, 1); !errors.Is(err, imagefetch.ErrNoImages) {
+		t.Errorf("expected an empty clowder to have no images, got %v", err)
+	}
+}
+
+func TestClowderScripts(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClowder(fake.Failing(1, errors.New("flaky"), fake.Markdown("<img src=\"cat.jpg\">"))...)
+	c.Cycle = true
+	for i, expected := range []string{"", "<img src=\"cat.jpg\">", ""} {
+		md, err := c.ReadCat(ctx, "", false, 0, 1)
+		if md != expected || (expected == "") != (err != nil) {
+			t.Errorf("call %d: expected %q, got %q (%v)", i, expected, md, err)
+		}
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	slow := fake.NewClowder(fake.Response{Delay: time.Hour, Do: cancel})
+	if _, err := slow.ReadCat(cancelled, "", false, 0, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the slow response to stop with the context, got %v", err)
+	}
+	if _, err := fake.NewClowder(fake.Slow(time.Millisecond, imagefetch.ErrNoImages)).ReadCat(ctx, "", false, 0, 1); !errors.Is(err, imagefetch.ErrNoImages) {
+		t.Errorf("expected the error once the delay is over, got %v", err)
+	}
+
+	c.Files = map[string][]byte{"https://example.com/cat.jpg": []byte("cat")}
+	if content, err := c.Download(ctx, "https://example.com/cat.jpg", 0); err != nil || string(content) != "cat" {
+		t.Errorf("expected the file, got %q (%v)", content, err)
+	}
+	if _, err := c.Download(ctx, "https://example.com/cat.jpg", 2); !errors.Is(err, imagefetch.ErrTooBig) {
+		t.Errorf("expected the file to be too big, got %v", err)
+	}
+	if _, err := c.Download(ctx, "https://example.com/dog.jpg", 0); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestServers(t *testing.T) {
+	img := fake.NewImageServer(10)
+	defer img.Close()
+	resp, err := http.Get(img.URL + "/cat.jpg")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "image/jpeg" || len(content) != 10 {
+		t.Errorf("expected a jpeg of 10 bytes, got %q of %d bytes", resp.Header.Get("Content-Type"), len(content))
+	}
+
+	api := fake.NewSearchServer("https://example.com/1.jpg", "https://example.com/2.jpg")
+	defer api.Close()
+	search := func() (int, string) {
+		resp, err := http.Get(api.URL + "/search")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	for _, expected := range []string{"1.jpg", "2.jpg", "1.jpg"} {
+		if status, body := search(); status != http.StatusOK || !strings.Contains(body, expected) {
+			t.Errorf("expected %s, got %d: %s", expected, status, body)
+		}
+	}
+	api.SetStatus(http.StatusServiceUnavailable)
+	if status, _ := search(); status != http.StatusServiceUnavailable {
+		t.Errorf("expected the api to be down, got %d", status)
+	}
+	api.SetStatus(0)
+	if status, body := search(); status != http.StatusOK || !strings.Contains(body, "2.jpg") {
+		t.Errorf("expected the next image once up again, got %d: %s", status, body)
+	}
+	if api.Requests() != 5 {
+		t.Errorf("expected 5 requests, got %d", api.Requests())
+	}
+	empty := fake.NewSearchServer()
+	defer empty.Close()
+	resp, err = http.Get(empty.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); strings.TrimSpace(string(body)) != "[]" {
+		t.Errorf("expected no cats, got %s", body)
+	}
+}
+
+func TestSCMClientComments(t *testing.T) {
+	c := fake.NewSCMClient("bot")
+	if err := c.CreateComment("org", "repo", 1, false, "on the issue"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.CreateComment("org", "repo", 1, true, "on the pr"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	comments, _ := c.ListIssueComments("org", "repo", 1)
+	if len(comments) != 1 || comments[0].Body != "on the issue" || comments[0].Author.Login != "bot" {
+		t.Errorf("expected the issue comment by the bot, got %+v", comments)
+	}
+	if err := c.DeleteComment("org", "repo", 1, comments[0].ID, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.DeleteComment("org", "repo", 1, comments[0].ID, false); err == nil {
+		t.Error("expected an error deleting a missing comment")
+	}
+	if bodies := c.Bodies(); len(bodies) != 1 || bodies[0] != "on the pr" {
+		t.Errorf("expected only the pr comment to be left, got %q", bodies)
+	}
+}
+
+func TestHandlePostsCat(t *testing.T) {
+	c := fake.NewClowder(fake.TooBig("https://example.com/big.jpg"), fake.Image("https://example.com/cat.jpg"))
+	spc := fake.NewSCMClient("bot")
+	match := plugins.CommandMatch{Name: "meow", Arg: "gif 2 tabby"}
+	if err := cat.Handle(context.Background(), plugins.Cat{}, match, spc, logrus.WithField("test", t.Name()), event("user"), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.Calls) != 2 {
+		t.Errorf("expected a retry after the too big cat, got %d calls", len(c.Calls))
+	}
+	if expected := (fake.Call{Category: "tabby", MovieCat: true, Count: 2}); c.Calls[0] != expected {
+		t.Errorf("expected call %+v, got %+v", expected, c.Calls[0])
+	}
+	bodies := spc.Bodies()
+	if len(bodies) != 1 || !strings.Contains(bodies[0], "https://example.com/cat.jpg") {
+		t.Errorf("expected a comment with the cat, got %q", bodies)
+	}
+}
+
+func TestHandleRepliesInThread(t *testing.T) {
+	for _, thread := range []string{"", "abc123"} {
+		c := fake.NewClowder(fake.Image("https://example.com/cat.jpg"), fake.Error(errors.New("boom")))
+		spc := fake.NewSCMClient("bot")
+		e := event("user")
+		e.ThreadID = thread
+		retries := 1
+		config := plugins.Cat{Retries: &retries}
+		if err := cat.Handle(context.Background(), config, plugins.CommandMatch{Name: "meow"}, spc, logrus.WithField("test", t.Name()), e, c); err != nil {
+			t.Fatalf("thread %q: unexpected error: %v", thread, err)
+		}
+		if err := cat.Handle(context.Background(), config, plugins.CommandMatch{Name: "meow"}, spc, logrus.WithField("test", t.Name()), e, c); err == nil {
+			t.Errorf("thread %q: expected an error when there are no cats", thread)
+		}
+		if len(spc.Comments) != 2 {
+			t.Fatalf("thread %q: expected the cat and the failure to be posted, got %d comments", thread, len(spc.Comments))
+		}
+		for _, comment := range spc.Comments {
+			if comment.ThreadID != thread {
+				t.Errorf("thread %q: expected the reply in the thread, got %q", thread, comment.ThreadID)
+			}
+		}
+	}
+}
+
+func TestHandleTo(t *testing.T) {
+	c := fake.NewClowder(fake.Image("https://example.com/cat.jpg"), fake.Error(errors.New("boom")))
+	spc := fake.NewSCMClient("bot")
+	e := event("user")
+	e.ThreadID = "abc123"
+	to := cat.Target{Org: "cats", Repo: "tracking", Number: 42}
+	retries := 1
+	config := plugins.Cat{Retries: &retries}
+	if err := cat.HandleTo(context.Background(), config, plugins.CommandMatch{Name: "meow"}, spc, logrus.WithField("test", t.Name()), e, c, to); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cat.HandleTo(context.Background(), config, plugins.CommandMatch{Name: "meow"}, spc, logrus.WithField("test", t.Name()), e, c, to); err == nil {
+		t.Error("expected an error when there are no cats")
+	}
+	if len(spc.Comments) != 2 {
+		t.Fatalf("expected the cat and the failure to be posted, got %d comments", len(spc.Comments))
+	}
+	for _, comment := range spc.Comments {
+		if comment.Org != "cats" || comment.Repo != "tracking" || comment.Number != 42 || comment.PR || comment.ThreadID != "" {
+			t.Errorf("expected the comment on cats/tracking#42, got %+v", comment)
+		}
+	}
+	if !strings.Contains(spc.Comments[0].Body, "https://example.com/cat.jpg") {
+		t.Errorf("expected the cat on the target, got %q", spc.Comments[0].Body)
+	}
+
+	spc = fake.NewSCMClient("bot")
+	if err := cat.Handle(context.Background(), plugins.Cat{}, plugins.CommandMatch{Name: "meow"}, spc, logrus.WithField("test", t.Name()), event("user"), fake.NewClowder(fake.Image("https://example.com/cat.jpg"))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(spc.Comments) != 1 || spc.Comments[0].Org != "org" || spc.Comments[0].Repo != "repo" || spc.Comments[0].Number != 5 {
+		t.Errorf("expected the reply in place, got %+v", spc.Comments)
+	}
+}
+
+func TestHandleRetriesComment(t *testing.T) {
+	unavailable := errors.New("503 Service Unavailable")
+	c := fake.NewClowder(fake.Image("https://example.com/cat.jpg"))
+	spc := fake.NewSCMClient("bot")
+	spc.CommentErrs = []error{unavailable, unavailable}
+	if err := cat.Handle(context.Background(), plugins.Cat{}, plugins.CommandMatch{Name: "meow"}, spc, logrus.WithField("test", t.Name()), event("user"), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bodies := spc.Bodies(); len(bodies) != 1 || !strings.Contains(bodies[0], "https://example.com/cat.jpg") {
+		t.Errorf("expected the cat to be posted on the third attempt, got %q", bodies)
+	}
+	if len(c.Calls) != 1 {
+		t.Errorf("expected the cat to be read once, got %d calls", len(c.Calls))
+	}
+
+	spc = fake.NewSCMClient("bot")
+	spc.CommentErrs = []error{unavailable, unavailable, unavailable}
+	err := cat.Handle(context.Background(), plugins.Cat{}, plugins.CommandMatch{Name: "meow"}, spc, logrus.WithField("test", t.Name()), event("user"), c)
+	if !errors.Is(err, unavailable) || !strings.Contains(err.Error(), "could not post the cat") {
+		t.Errorf("expected the cat could not be posted, got %v", err)
+	}
+	if bodies := spc.Bodies(); len(bodies) != 0 {
+		t.Errorf("expected no comment, got %q", bodies)
+	}
+}
+
+func TestHandleReportsFailure(t *testing.T) {
+	retries := 1
+	c := fake.NewClowder(fake.Error(errors.New("no cats today")))
+	spc := fake.NewSCMClient("bot")
+	if err := cat.Handle(context.Background(), plugins.Cat{Retries: &retries}, plugins.CommandMatch{Name: "meow"}, spc, logrus.WithField("test", t.Name()), event("user"), c); err == nil {
+		t.Error("expected an error when there are no cats")
+	}
+	if bodies := spc.Bodies(); len(bodies) != 1 || strings.Contains(bodies[0], "![") {
+		t.Errorf("expected a single failure comment, got %q", bodies)
+	}
+}
+
+func TestHandleRequireMember(t *testing.T) {
+	c := fake.NewClowder(fake.Image("https://example.com/cat.jpg"))
+	spc := fake.NewSCMClient("bot")
+	spc.Members = []string{"member"}
+	config := plugins.Cat{RequireMember: true}
+	for _, author := range []string{"stranger", "member"} {
+		if err := cat.Handle(context.Background(), config, plugins.CommandMatch{Name: "meow"}, spc, logrus.WithField("test", t.Name()), event(author), c); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(c.Calls) != 1 {
+		t.Errorf("expected only the member to get a cat, got %d calls", len(c.Calls))
+	}
+	bodies := spc.Bodies()
+	if len(bodies) != 2 || strings.Contains(bodies[0], "cat.jpg") || !strings.Contains(bodies[1], "cat.jpg") {
+		t.Errorf("expected a refusal then a cat, got %q", bodies)
+	}
+}
+
+func TestHandleReplacePrevious(t *testing.T) {
+	c := fake.NewClowder(fake.Image("https://example.com/1.jpg"), fake.Image("https://example.com/2.jpg"))
+	spc := fake.NewSCMClient("bot")
+	config := plugins.Cat{ReplacePrevious: true}
+	for i := 0; i < 2; i++ {
+		if err := cat.Handle(context.Background(), config, plugins.CommandMatch{Name: "meow"}, spc, logrus.WithField("test", t.Name()), event("user"), c); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	bodies := spc.Bodies()
+	if len(bodies) != 1 || !strings.Contains(bodies[0], "https://example.com/2.jpg") {
+		t.Errorf("expected only the second cat to be left, got %q", bodies)
+	}
+}
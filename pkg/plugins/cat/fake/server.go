@@ -0,0 +1,72 @@
+package fake
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+)
+
+// NewImageServer serves a jpeg of the size at any path, the HEAD requests
+// checking the size of the cats get its headers only.
+func NewImageServer(size int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		if r.Method != http.MethodHead {
+			w.Write(bytes.Repeat([]byte("c"), size))
+		}
+	}))
+}
+
+// SearchServer is a cat api answering each search with the next of its
+// images, starting over once they run out.
+type SearchServer struct {
+	*httptest.Server
+	Images []string
+
+	requests int32
+	searches int32
+	status   int32
+}
+
+// NewSearchServer serves the images, one per search
+func NewSearchServer(images ...string) *SearchServer {
+	s := &SearchServer{Images: images}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.requests, 1)
+		if status := int(atomic.LoadInt32(&s.status)); status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+		served := int(atomic.AddInt32(&s.searches, 1)) - 1
+		cats := []map[string]string{}
+		if len(s.Images) > 0 {
+			cats = append(cats, map[string]string{"id": "cat", "url": s.Images[served%len(s.Images)]})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cats)
+	}))
+	return s
+}
+
+// NewFailingServer is a cat api failing every request with the status
+func NewFailingServer(status int) *SearchServer {
+	s := NewSearchServer()
+	s.SetStatus(status)
+	return s
+}
+
+// SetStatus fails the requests with the status from now on, e.g.
+// http.StatusServiceUnavailable for an api that is down, 0 serves the images
+// again.
+func (s *SearchServer) SetStatus(status int) {
+	atomic.StoreInt32(&s.status, int32(status))
+}
+
+// Requests returns the number of requests served, the failed ones included
+func (s *SearchServer) Requests() int {
+	return int(atomic.LoadInt32(&s.requests))
+}
@@ -0,0 +1,165 @@
+package cat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jenkins-x/lighthouse/pkg/plugins"
+	"github.com/jenkins-x/lighthouse/pkg/plugins/imagefetch"
+	"github.com/sirupsen/logrus"
+)
+
+// FetchOptions describe the cat asked for with FetchImage
+type FetchOptions struct {
+	// Config is the cat plugin configuration the cat is looked for with
+	Config plugins.Cat
+	// Category of the cat, empty picks one of Config.DefaultCategories or any cat
+	Category string
+	// Movie asks for a gif as /meowvie does
+	Movie bool
+	// Count is the number of cats, clamped between 1 and the 5 of a comment
+	Count int
+	// Clowder finds the cats, nil uses the one of the plugin set up with Config
+	Clowder Clowder
+	// Log defaults to the standard logger
+	Log *logrus.Entry
+}
+
+// FetchImage returns the markdown of a cat checked as the ones posted for
+// /meow, for components which post cats without a command, e.g. in a welcome
+// message. Categories that can't be asked for with the configuration are
+// turned down with an error.
+func FetchImage(ctx context.Context, opts FetchOptions) (string, error) {
+	config := opts.Config
+	log := opts.Log
+	if log == nil {
+		log = logrus.NewEntry(logrus.StandardLogger())
+	}
+	category := opts.Category
+	if category == "" {
+		category = pickCategory(config.DefaultCategories, nil)
+	}
+	category, err := checkCategory(config, category)
+	if err != nil {
+		return "", err
+	}
+
+	c := opts.Clowder
+	if c == nil {
+		meow.configure(config, log)
+		meow.setKey(config.KeyPath, config.KeySecret, config.KeyReloadIntervalDuration, nil, log)
+		c = meow
+	}
+	fetches.configure(config.MaxConcurrentFetches, config.FetchQueueWaitDuration)
+	release, err := fetches.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	search, cancel := searchBudget(ctx, config)
+	defer cancel()
+	return findCat(ctx, search, config, c, category, opts.Movie, clampCount(opts.Count), log, nil, "")
+}
+
+// searchBudget bounds the search for a cat by Cat.MaxTotalTime when it is set
+func searchBudget(ctx context.Context, config plugins.Cat) (context.Context, context.CancelFunc) {
+	if config.MaxTotalTimeDuration > 0 {
+		return context.WithTimeout(ctx, config.MaxTotalTimeDuration)
+	}
+	return ctx, func() {}
+}
+
+// findCat asks the clowder for a cat until one is found or the attempts run
+// out. A cat recently posted on the issue is only returned when there is no
+// other, then a local cat. The search context bounds the search while ctx
+// being done gives up altogether.
+func findCat(ctx, search context.Context, config plugins.Cat, c Clowder, category string, movieCat bool, count int, log *logrus.Entry, recent *recentCats, issue string) (string, error) {
+	maxRetryAfter := config.MaxRetryAfterDuration
+	if maxRetryAfter <= 0 {
+		maxRetryAfter = defaultMaxRetryAfter
+	}
+
+	var duplicate string
+	var lastErr error
+	var wait time.Duration
+	backoff := config.Backoff()
+	overBudget := func() bool {
+		if search.Err() == nil || ctx.Err() != nil {
+			return false
+		}
+		log.Warnf("Spent the %v allowed looking for a cat, giving up", config.MaxTotalTimeDuration)
+		lastErr = imagefetch.Transient(fmt.Errorf("spent the %v allowed looking for a cat", config.MaxTotalTimeDuration))
+		return true
+	}
+	for i := 0; i < config.Attempts(); i++ {
+		if i > 0 {
+			// a rate limited provider may ask to wait longer than the backoff
+			delay := backoff.Delay(i)
+			if wait > delay {
+				delay = wait
+			}
+			if err := sleep(search, delay); err != nil {
+				if overBudget() {
+					break
+				}
+				return "", fmt.Errorf("gave up looking for a cat: %w", err)
+			}
+		}
+		wait = 0
+		resp, err := tracedReadCat(search, c, category, movieCat, config.MaxImageSizeBytes, count)
+		if err != nil && movieCat && config.StaticFallback && isError(err, errTooBig) && search.Err() == nil {
+			log.WithError(err).Info("The gif is too big, asking for a still cat instead")
+			movieCat = false
+			resp, err = tracedReadCat(search, c, category, movieCat, config.MaxImageSizeBytes, count)
+		}
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("gave up looking for a cat: %w", ctx.Err())
+		}
+		if err != nil && overBudget() {
+			break
+		}
+		if err != nil {
+			log.WithError(err).Error("Failed to get cat img")
+			lastErr = err
+			if !shouldRetry(err) || !retriesStatus(config, err) {
+				break
+			}
+			if after, ok := retryAfter(err); ok {
+				if after > maxRetryAfter {
+					log.Warnf("Rate limited for %v which is longer than %v, giving up", after, maxRetryAfter)
+					break
+				}
+				wait = after
+			}
+			continue
+		}
+		if recent.seen(issue, imageURLs(resp)...) {
+			log.Info("Got a cat that was recently posted, looking for another")
+			duplicate = resp
+			if cc, ok := c.(cachingClowder); ok {
+				cc.forget(category, movieCat, config.MaxImageSizeBytes, count)
+			}
+			continue
+		}
+		return resp, nil
+	}
+	// a repeated cat is still better than no cat at all
+	if duplicate != "" {
+		return duplicate, nil
+	}
+	if l, ok := c.(localClowder); ok {
+		resp, err := l.readLocalCat()
+		if err == nil {
+			return resp, nil
+		}
+		if !errors.Is(err, errLocalDisabled) {
+			log.WithError(err).Error("Failed to get local cat img")
+		}
+	}
+	if lastErr == nil {
+		lastErr = errNoCats
+	}
+	return "", lastErr
+}
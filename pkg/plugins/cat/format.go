@@ -0,0 +1,48 @@
+package cat
+
+import "github.com/jenkins-x/lighthouse/pkg/plugins/imagefetch"
+
+// the markup the cats can be posted with, see Cat.ImageFormat
+const (
+	markdownFormat = "markdown"
+	htmlFormat     = "html"
+)
+
+// imageFormatter returns the markup showing the image, e.g. imagefetch.Markdown
+type imageFormatter func(alt, image string) (string, error)
+
+// imageFormatters are the formatters by the name of their markup
+var imageFormatters = map[string]imageFormatter{
+	markdownFormat: imagefetch.Markdown,
+	htmlFormat:     imagefetch.HTML,
+}
+
+// setImageFormats sets the markup of the cats, and of the cats of the providers
+// whose markup isn't that one
+func (c *realClowder) setImageFormats(format string, providers map[string]string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.imageFormat = format
+	c.providerFormats = providers
+}
+
+// formatter returns the formatter of the cats found with the provider,
+// markdown unless configured otherwise
+func (c *realClowder) formatter(provider string) imageFormatter {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	format := c.imageFormat
+	if f, ok := c.providerFormats[provider]; ok {
+		format = f
+	}
+	if f, ok := imageFormatters[format]; ok {
+		return f
+	}
+	return imagefetch.Markdown
+}
+
+// format returns the comment showing the cats, each in the markup of the
+// provider it was found with
+func (c *realClowder) format(cats catResults) (string, error) {
+	return cats.FormatWith(c.formatter, c.caption())
+}
@@ -0,0 +1,61 @@
+package cat
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// imagePath returns the json path of the image urls returned by the provider,
+// empty for providers that answer as thecatapi.com does
+func (c *realClowder) imagePath(provider string) string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.imagePaths[provider]
+}
+
+// setImagePaths sets the json paths of the image urls by provider url
+func (c *realClowder) setImagePaths(paths map[string]string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.imagePaths = paths
+}
+
+// decodeImagePath returns the cats at the json path of the body, see
+// plugins.Cat.ImagePaths. Numbers index into lists and `*` is each item of a
+// list, the path has to end on the image urls.
+func decodeImagePath(body []byte, path string) ([]catResult, error) {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	nodes := []interface{}{doc}
+	for _, segment := range strings.Split(path, ".") {
+		var next []interface{}
+		for _, node := range nodes {
+			switch v := node.(type) {
+			case map[string]interface{}:
+				if child, ok := v[segment]; ok {
+					next = append(next, child)
+				}
+			case []interface{}:
+				if segment == "*" {
+					next = append(next, v...)
+				} else if i, err := strconv.Atoi(segment); err == nil && i >= 0 && i < len(v) {
+					next = append(next, v[i])
+				}
+			}
+		}
+		nodes = next
+	}
+	cats := make([]catResult, 0, len(nodes))
+	for _, node := range nodes {
+		image, ok := node.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an image url but %T", path, node)
+		}
+		cats = append(cats, catResult{Image: image})
+	}
+	return cats, nil
+}
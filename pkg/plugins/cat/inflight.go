@@ -0,0 +1,68 @@
+package cat
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// errBusy is returned when too many cats are already being looked for
+var errBusy = errors.New("too many cats are being looked for at once")
+
+// busyMessage is the reply when Cat.MaxConcurrentFetches cats are already being
+// looked for
+const busyMessage = "Too many cats are being looked for right now, please try again in a moment."
+
+// fetchSlots bounds the cats looked for at once by all the cat requests, so
+// that a slow provider doesn't tie up every plugin worker.
+type fetchSlots struct {
+	lock  sync.Mutex
+	slots chan struct{}
+	wait  time.Duration
+}
+
+// configure sets the most cats looked for at once, zero for no bound, and the
+// longest a request waits for a slot. The fetches in flight keep the slot
+// they got when the bound changes.
+func (s *fetchSlots) configure(max int, wait time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.wait = wait
+	switch {
+	case max <= 0:
+		s.slots = nil
+	case s.slots == nil || cap(s.slots) != max:
+		s.slots = make(chan struct{}, max)
+	}
+}
+
+// acquire waits for a slot, failing with errBusy when none frees up within the
+// configured wait. The returned func gives the slot back.
+func (s *fetchSlots) acquire(ctx context.Context) (func(), error) {
+	s.lock.Lock()
+	slots, wait := s.slots, s.wait
+	s.lock.Unlock()
+	if slots == nil {
+		return func() {}, nil
+	}
+	release := func() { <-slots }
+	select {
+	case slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if wait <= 0 {
+		return nil, errBusy
+	}
+	timer := pluginClock.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C():
+		return nil, errBusy
+	}
+}
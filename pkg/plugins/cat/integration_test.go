@@ -0,0 +1,144 @@
+package cat
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/go-scm/scm/driver/fake"
+	"github.com/jenkins-x/lighthouse/pkg/plugins"
+	"github.com/jenkins-x/lighthouse/pkg/scmprovider"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeCatAPI serves the image search, breeds and categories of thecatapi.com
+// and the images it finds, the category asked for picks the answer: hats get a
+// small cat, boxes a cat too big to post, sinks a down api and anything else
+// is a bad category.
+type fakeCatAPI struct {
+	*httptest.Server
+
+	lock     sync.Mutex
+	searches map[string]int
+}
+
+func newFakeCatAPI(t *testing.T) *fakeCatAPI {
+	api := &fakeCatAPI{searches: map[string]int{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/images/search", func(w http.ResponseWriter, r *http.Request) {
+		category := r.URL.Query().Get("category")
+		api.lock.Lock()
+		api.searches[category]++
+		api.lock.Unlock()
+		switch category {
+		case "", "hats":
+			fmt.Fprintf(w, `[{"url":%q}]`, api.URL+"/images/small.jpg")
+		case "boxes":
+			fmt.Fprintf(w, `[{"url":%q}]`, api.URL+"/images/big.jpg")
+		case "sinks":
+			http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+		default:
+			http.Error(w, "unknown category", http.StatusBadRequest)
+		}
+	})
+	mux.HandleFunc("/v1/breeds", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/v1/categories", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":1,"name":"hats"},{"id":2,"name":"boxes"},{"id":3,"name":"sinks"}]`)
+	})
+	sizes := map[string]int{"/images/small.jpg": 1000, "/images/big.jpg": 5001}
+	mux.HandleFunc("/images/", func(w http.ResponseWriter, r *http.Request) {
+		size, ok := sizes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(make([]byte, size))
+		}
+	})
+	api.Server = httptest.NewServer(mux)
+	t.Cleanup(api.Close)
+	return api
+}
+
+func (api *fakeCatAPI) searched(category string) int {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+	return api.searches[category]
+}
+
+// TestIntegration runs the commands through handleGenericComment against the
+// fake api, with the clowder of the plugin rather than a fake one.
+func TestIntegration(t *testing.T) {
+	api := newFakeCatAPI(t)
+	cases := []struct {
+		name     string
+		body     string
+		category string
+		searches int
+		expected string
+	}{
+		{name: "cat", body: "/meow hats", category: "hats", searches: 1, expected: api.URL + "/images/small.jpg"},
+		{name: "any cat", body: "/meow", searches: 1, expected: api.URL + "/images/small.jpg"},
+		{name: "too big", body: "/meow boxes", category: "boxes", searches: 3, expected: noSuitableCatMessage},
+		{name: "down", body: "/meow sinks", category: "sinks", searches: 3, expected: downMessage},
+		{name: "bad category", body: "/meow space", category: "space", searches: 1, expected: badCategoryMessage},
+	}
+	for i, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// a clowder of its own keeps the breaker, cache and limiter of a case
+			// from the others
+			previous := meow
+			meow = &realClowder{local: &localImages{}}
+			defer func() { meow = previous }()
+
+			fakeScmClient, fc := fake.NewDefault()
+			fakeClient := scmprovider.ToTestClient(fakeScmClient)
+			agent := plugins.Agent{
+				SCMProviderClient: &fakeClient.Client,
+				Logger:            logrus.WithField("plugin", pluginName),
+				PluginConfig: &plugins.Configuration{
+					Cat: plugins.Cat{APIURL: api.URL, MaxImageSizeBytes: 5000, RequireHTTPS: &plainHTTP},
+				},
+			}
+			number := 100 + i
+			e := scmprovider.GenericCommentEvent{
+				Action:     scm.ActionCreate,
+				Body:       tc.body,
+				Number:     number,
+				IssueState: "open",
+				Repo:       scm.Repository{Namespace: "org", Name: "repo"},
+				Author:     scm.User{Login: "octocat"},
+			}
+			match := plugins.CommandMatch{Name: "meow", Arg: tc.category}
+			before := api.searched(tc.category)
+			err := handleGenericComment(match, agent, e)
+			posted := strings.HasPrefix(tc.expected, api.URL)
+			if posted && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !posted && err == nil {
+				t.Error("expected an error")
+			}
+			if searches := api.searched(tc.category) - before; searches != tc.searches {
+				t.Errorf("expected %d searches, got %d", tc.searches, searches)
+			}
+			comments := fc.IssueComments[number]
+			if len(comments) != 1 {
+				t.Fatalf("expected 1 comment, got %d", len(comments))
+			}
+			if body := comments[0].Body; !strings.Contains(body, tc.expected) {
+				t.Errorf("expected the comment to contain %q, got %q", tc.expected, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package cat
+
+import (
+	"math/rand"
+	"time"
+)
+
+// jittered spreads d by up to factor of itself either way, random returns a
+// number in [0, 1) and defaults to math/rand.
+func jittered(d time.Duration, factor float64, random func() float64) time.Duration {
+	if d <= 0 || factor <= 0 {
+		return d
+	}
+	if random == nil {
+		random = rand.Float64
+	}
+	return d + time.Duration(float64(d)*factor*(2*random()-1))
+}
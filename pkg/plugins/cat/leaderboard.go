@@ -0,0 +1,136 @@
+package cat
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jenkins-x/lighthouse/pkg/plugins"
+	"github.com/jenkins-x/lighthouse/pkg/scmprovider"
+	"github.com/sirupsen/logrus"
+)
+
+// leaderboardSize is the number of cat summoners listed by /meow leaderboard
+const leaderboardSize = 10
+
+// board counts the cats summoned with Cat.Leaderboard, see SetLeaderboardStore
+var board LeaderboardStore = newMemoryLeaderboard()
+
+// LeaderboardStore keeps count of the cats each user summoned in a repo
+type LeaderboardStore interface {
+	// Increment counts one more cat summoned by the user in the org/repo
+	Increment(repo, user string) error
+	// Counts returns the number of cats summoned by each user in the org/repo
+	Counts(repo string) (map[string]int, error)
+}
+
+// SetLeaderboardStore replaces the in-memory counts of the leaderboard, e.g.
+// with a store that survives restarts.
+func SetLeaderboardStore(store LeaderboardStore) {
+	board = store
+}
+
+// memoryLeaderboard is a LeaderboardStore that is lost on restart
+type memoryLeaderboard struct {
+	lock   sync.Mutex
+	counts map[string]map[string]int
+}
+
+func newMemoryLeaderboard() *memoryLeaderboard {
+	return &memoryLeaderboard{counts: map[string]map[string]int{}}
+}
+
+// Increment counts one more cat summoned by the user in the repo
+func (m *memoryLeaderboard) Increment(repo, user string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.counts[repo] == nil {
+		m.counts[repo] = map[string]int{}
+	}
+	m.counts[repo][user]++
+	return nil
+}
+
+// Counts returns a copy of the counts of the repo
+func (m *memoryLeaderboard) Counts(repo string) (map[string]int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	counts := make(map[string]int, len(m.counts[repo]))
+	for user, n := range m.counts[repo] {
+		counts[user] = n
+	}
+	return counts, nil
+}
+
+type summoner struct {
+	login string
+	cats  int
+}
+
+// isLeaderboardCommand returns true for the argument asking for the leaderboard
+func isLeaderboardCommand(arg string) bool {
+	return strings.EqualFold(strings.TrimSpace(arg), "leaderboard")
+}
+
+// countCat records a cat summoned by the author of the event
+func countCat(store LeaderboardStore, log *logrus.Entry, e *scmprovider.GenericCommentEvent) {
+	if store == nil || e.Author.Login == "" {
+		return
+	}
+	if err := store.Increment(e.Repo.Namespace+"/"+e.Repo.Name, e.Author.Login); err != nil {
+		log.WithError(err).Warn("Failed to count the cat on the leaderboard")
+	}
+}
+
+// topSummoners returns up to n users with the most cats, users with as many
+// cats are ordered by login.
+func topSummoners(counts map[string]int, n int) []summoner {
+	summoners := make([]summoner, 0, len(counts))
+	for login, cats := range counts {
+		summoners = append(summoners, summoner{login: login, cats: cats})
+	}
+	sort.Slice(summoners, func(i, j int) bool {
+		if summoners[i].cats != summoners[j].cats {
+			return summoners[i].cats > summoners[j].cats
+		}
+		return summoners[i].login < summoners[j].login
+	})
+	if len(summoners) > n {
+		summoners = summoners[:n]
+	}
+	return summoners
+}
+
+// leaderboardMessage renders the top cat summoners of the repo
+func leaderboardMessage(repo string, summoners []summoner) string {
+	if len(summoners) == 0 {
+		return fmt.Sprintf("No cats have been summoned in %s yet.", repo)
+	}
+	lines := []string{fmt.Sprintf("The top cat summoners in %s are:", repo), ""}
+	for i, s := range summoners {
+		cats := "cats"
+		if s.cats == 1 {
+			cats = "cat"
+		}
+		lines = append(lines, fmt.Sprintf("%d. `%s`: %d %s", i+1, s.login, s.cats, cats))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// handleLeaderboard replies with the users who summoned the most cats in the repo
+func handleLeaderboard(format plugins.ResponseFormatter, spc SCMProviderClient, log *logrus.Entry, e *scmprovider.GenericCommentEvent, store LeaderboardStore) error {
+	org := e.Repo.Namespace
+	repo := e.Repo.Name
+	if format == nil {
+		format = plugins.FormatResponseRaw
+	}
+	full := org + "/" + repo
+	counts, err := store.Counts(full)
+	if err != nil {
+		log.WithError(err).Warn("Failed to read the cat leaderboard")
+		return spc.CreateCommentReply(org, repo, e.Number, e.IsPR, e.ThreadID, format(e.Body, e.Link, spc.QuoteAuthorForComment(e.AuthorMention()), "Sorry, the cat leaderboard can't be read right now."))
+	}
+	msg := leaderboardMessage(full, topSummoners(counts, leaderboardSize))
+	return spc.CreateCommentReply(org, repo, e.Number, e.IsPR, e.ThreadID, format(e.Body, e.Link, spc.QuoteAuthorForComment(e.AuthorMention()), msg))
+}
@@ -0,0 +1,63 @@
+package cat
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// legacyAPIVersion is the api of thecatapi.com before v1, which answers the
+// image searches with xml
+const legacyAPIVersion = "v0"
+
+// legacyResponse is the xml answer of the legacy api, e.g.
+//
+//	<response><data><images><image><url>https://...</url></image></images></data></response>
+type legacyResponse struct {
+	Images []struct {
+		URL string `xml:"url"`
+	} `xml:"data>images>image"`
+}
+
+// apiSearchURL is the image search url of the version of the api at the base url
+func apiSearchURL(base, version string) string {
+	if version == legacyAPIVersion {
+		return base + "/api/images/get?format=xml"
+	}
+	return searchURL(base)
+}
+
+// setAPIVersion pins the version of the api the image search of the api url
+// uses, empty for v1.
+func (c *realClowder) setAPIVersion(version string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if version == c.apiVersion {
+		return
+	}
+	c.apiVersion = version
+	c.url = apiSearchURL(apiBase(c.apiURL), version)
+}
+
+// legacyAPI returns true if the responses are decoded as the legacy api's
+func (c *realClowder) legacyAPI() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.apiVersion == legacyAPIVersion
+}
+
+// decodeLegacyCats reads the images of a response of the legacy api. A mirror
+// that already answers with json is decoded as the current api.
+func decodeLegacyCats(body []byte) ([]catResult, error) {
+	if trimmed := strings.TrimSpace(string(body)); strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+		return decodeCats(body)
+	}
+	var resp legacyResponse
+	if err := xml.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	cats := make([]catResult, 0, len(resp.Images))
+	for _, image := range resp.Images {
+		cats = append(cats, catResult{Image: image.URL})
+	}
+	return cats, nil
+}
@@ -0,0 +1,127 @@
+package cat
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LocalImagePath is the path under which the images in Cat.LocalImageDir are served
+const LocalImagePath = "/cat/images/"
+
+// localRefreshPeriod is how long a directory listing is cached for
+const localRefreshPeriod = 5 * time.Minute
+
+var errLocalDisabled = errors.New("no local image directory configured")
+
+// localClowder can find a cat without asking a remote provider
+type localClowder interface {
+	readLocalCat() (string, error)
+}
+
+// localImages serves the images found in a local directory
+type localImages struct {
+	lock    sync.RWMutex
+	dir     string
+	baseURL string
+	images  []string
+	refresh time.Time
+}
+
+// LocalImageHandler serves the images from the configured local image directory
+func LocalImageHandler() http.Handler {
+	return http.StripPrefix(LocalImagePath, meow.local)
+}
+
+// configure sets the directory to serve and the base URL it is reachable at,
+// the listing is refreshed when the directory changes.
+func (l *localImages) configure(dir, baseURL string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.dir != dir {
+		l.images = nil
+		l.refresh = time.Time{}
+	}
+	l.dir = dir
+	l.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+// list returns the cached images, refreshing the listing when it is stale
+func (l *localImages) list() (string, []string, error) {
+	l.lock.RLock()
+	dir, images, fresh := l.dir, l.images, pluginClock.Now().Before(l.refresh)
+	l.lock.RUnlock()
+	if dir == "" {
+		return "", nil, errLocalDisabled
+	}
+	if fresh {
+		return dir, images, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return dir, nil, fmt.Errorf("could not list local images in %s: %w", dir, err)
+	}
+	images = nil
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && isImage(entry.Name()) {
+			images = append(images, entry.Name())
+		}
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.dir == dir {
+		l.images = images
+		l.refresh = pluginClock.Now().Add(localRefreshPeriod)
+	}
+	return dir, images, nil
+}
+
+func (l *localImages) readLocalCat() (string, error) {
+	dir, images, err := l.list()
+	if err != nil {
+		return "", err
+	}
+	if len(images) == 0 {
+		return "", fmt.Errorf("no images in %s", dir)
+	}
+	l.lock.RLock()
+	baseURL := l.baseURL
+	l.lock.RUnlock()
+	if baseURL == "" {
+		return "", errors.New("no local image url configured")
+	}
+	img := images[rand.Intn(len(images))] // #nosec
+	return catResult{Image: baseURL + LocalImagePath + img}.Format(false)
+}
+
+// ServeHTTP serves an image from the listing, anything else is not found
+func (l *localImages) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	dir, images, err := l.list()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	for _, img := range images {
+		if img == r.URL.Path {
+			http.ServeFile(w, r, filepath.Join(dir, img))
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func isImage(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp":
+		return true
+	}
+	return false
+}
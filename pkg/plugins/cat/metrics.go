@@ -0,0 +1,77 @@
+package cat
+
+import (
+	"errors"
+
+	"github.com/jenkins-x/lighthouse/pkg/plugins/imagefetch"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	sourceAPI    = "api"
+	sourceGrumpy = "grumpy"
+	sourceCache  = "cache"
+
+	outcomeSuccess   = "success"
+	outcomeHTTPError = "http_error"
+	outcomeTooBig    = "too_big"
+	outcomeEmpty     = "empty"
+	outcomeInvalid   = "invalid"
+	outcomeCategory  = "bad_category"
+	outcomeUnknownID = "unknown_id"
+	outcomeOpen      = "circuit_open"
+	outcomeThrottled = "throttled"
+)
+
+var (
+	errTooBig    = imagefetch.ErrTooBig
+	errNoCats    = imagefetch.ErrNoImages
+	errInvalid   = imagefetch.ErrInvalid
+	errTransient = imagefetch.ErrTransient
+	// errBadCategory is for categories the provider doesn't know, asking again won't help
+	errBadCategory = errors.New("bad category")
+	// errUnknownID is for image ids the provider doesn't know, asking again won't help
+	errUnknownID = errors.New("unknown cat id")
+)
+
+var (
+	// Define all metrics for the cat plugin here.
+	readAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "lighthouse_cat_read_attempts",
+		Help: "A counter of the attempts made to read a cat, by source and outcome.",
+	}, []string{"source", "outcome"})
+	apiLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "lighthouse_cat_api_latency_seconds",
+		Help:    "Time for a request to roundtrip between lighthouse and the cat api.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+// recordRead counts a read attempt from the source, classified by its error
+func recordRead(source string, err error) {
+	readAttempts.WithLabelValues(source, outcome(err)).Inc()
+}
+
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return outcomeSuccess
+	case errors.Is(err, errTooBig):
+		return outcomeTooBig
+	case errors.Is(err, errNoCats):
+		return outcomeEmpty
+	case errors.Is(err, errInvalid):
+		return outcomeInvalid
+	case errors.Is(err, errBadCategory):
+		return outcomeCategory
+	case errors.Is(err, errUnknownID):
+		return outcomeUnknownID
+	case errors.Is(err, errCircuitOpen):
+		return outcomeOpen
+	case errors.Is(err, errThrottled):
+		return outcomeThrottled
+	default:
+		return outcomeHTTPError
+	}
+}
@@ -0,0 +1,76 @@
+package cat
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// OfflineImagePath is the path under which the image posted in Cat.Offline mode
+// and the embedded grumpy cat are served
+const OfflineImagePath = "/cat/offline/"
+
+// offlineImage is the image posted in offline mode
+const offlineImage = "offline-cat.png"
+
+// embeddedGrumpy is the grumpy cat posted when the grumpy image can't be
+const embeddedGrumpy = "grumpy-cat.png"
+
+// offlineAssets are the images served by OfflineImageHandler, a missing one
+// fails the build and the tests check that they are images
+//
+//go:embed assets/offline-cat.png assets/grumpy-cat.png
+var offlineAssets embed.FS
+
+var errOffline = errors.New("the cat api is not used in offline mode")
+
+// OfflineImageHandler serves the image posted in offline mode and the embedded
+// grumpy cat
+func OfflineImageHandler() http.Handler {
+	assets, err := fs.Sub(offlineAssets, "assets")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix(OfflineImagePath, http.FileServer(http.FS(assets)))
+}
+
+// setOffline sets whether the bundled image is always posted, served from the
+// base URL of the bot, instead of asking the providers
+func (c *realClowder) setOffline(offline bool, baseURL string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.offline = offline
+	c.offlineURL = strings.TrimSuffix(baseURL, "/")
+}
+
+func (c *realClowder) isOffline() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.offline
+}
+
+// readOfflineCat returns the markdown for the bundled image, it isn't checked
+// as it is known to be small enough.
+func (c *realClowder) readOfflineCat() (string, error) {
+	c.lock.RLock()
+	baseURL := c.offlineURL
+	c.lock.RUnlock()
+	if baseURL == "" {
+		return "", errors.New("no local image url configured for offline mode")
+	}
+	return c.format(catResults{{Image: baseURL + OfflineImagePath + offlineImage}})
+}
+
+// embeddedGrumpyCat returns the embedded grumpy cat served from the base URL of
+// the bot, it isn't checked as it is known to be small enough.
+func (c *realClowder) embeddedGrumpyCat() (catResults, error) {
+	c.lock.RLock()
+	baseURL := c.offlineURL
+	c.lock.RUnlock()
+	if baseURL == "" {
+		return nil, errors.New("no local image url configured for the embedded grumpy cat")
+	}
+	return catResults{{Image: baseURL + OfflineImagePath + embeddedGrumpy, MimeType: "image/png"}}, nil
+}
@@ -0,0 +1,90 @@
+package cat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jenkins-x/lighthouse/pkg/plugins"
+	"github.com/sirupsen/logrus"
+)
+
+// ofTheDay posts Cat.OfTheDay on its schedule
+var ofTheDay = plugins.Periodic{
+	Name:     "cat-of-the-day",
+	Schedule: ofTheDaySchedule,
+	Handler: func(pc plugins.Agent) error {
+		ctx := pc.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		return postCatOfTheDay(ctx, pc.PluginConfig, pc.SCMProviderClient, pc.Logger, meow)
+	},
+}
+
+func ofTheDaySchedule(config *plugins.Configuration) string {
+	return config.Cat.OfTheDay.Schedule
+}
+
+// postCatOfTheDay comments with a cat from the clowder on the issue of
+// Cat.OfTheDay, with the settings of its repo. With Cat.ReplacePrevious the
+// cat of the day before goes away.
+func postCatOfTheDay(ctx context.Context, pluginConfig *plugins.Configuration, spc SCMProviderClient, log *logrus.Entry, c Clowder) error {
+	day := pluginConfig.Cat.OfTheDay
+	parts := strings.Split(day.Repo, "/")
+	if len(parts) != 2 {
+		return fmt.Errorf("the cat of the day repo %q is not of the form org/repo", day.Repo)
+	}
+	to := Target{Org: parts[0], Repo: parts[1], Number: day.Number}
+	config, enabled := pluginConfig.CatFor(to.Org, to.Repo)
+	if !enabled || !pluginEnabled(pluginConfig, to.Org, to.Repo) {
+		return fmt.Errorf("the cat plugin is not enabled in %s", day.Repo)
+	}
+	log = log.WithField("target", to.String())
+
+	resp, err := FetchImage(ctx, FetchOptions{Config: config, Category: day.Category, Clowder: c, Log: log})
+	if err != nil {
+		return fmt.Errorf("could not find the cat of the day: %w", err)
+	}
+	if config.ReplacePrevious {
+		if err := deletePreviousCats(spc, to.Org, to.Repo, to.Number, to.IsPR); err != nil {
+			log.WithError(err).Warn("Failed to delete the previous cat")
+		}
+	}
+	comment, fits := fitComment(withFact(ctx, config, c, log, resp), config.CommentLengthLimit(), func(body string) string { return body + catMarker })
+	if !fits {
+		log.Warnf("The cat of the day is still longer than the %d bytes of a comment, posting it anyway", config.CommentLengthLimit())
+	}
+	if err := tracedComment(ctx, to, func() error {
+		return retryComment(ctx, config, log, func() error {
+			return spc.CreateComment(to.Org, to.Repo, to.Number, to.IsPR, comment)
+		})
+	}); err != nil {
+		return err
+	}
+	log.WithField("image", strings.Join(imageURLs(resp), ",")).Info("Posted the cat of the day")
+	return nil
+}
+
+// pluginEnabled returns true if the cat plugin is enabled for the org or the repo
+func pluginEnabled(config *plugins.Configuration, org, repo string) bool {
+	orgs, repos := config.EnabledReposForPlugin(pluginName)
+	for _, o := range orgs {
+		if o == org {
+			return true
+		}
+	}
+	for _, r := range repos {
+		if r == org+"/"+repo {
+			return true
+		}
+	}
+	return false
+}
+
+func ofTheDayHelp(day plugins.CatOfTheDay) string {
+	if day.Schedule == "" {
+		return "off"
+	}
+	return fmt.Sprintf("%s#%d at %s", day.Repo, day.Number, day.Schedule)
+}
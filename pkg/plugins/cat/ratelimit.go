@@ -0,0 +1,66 @@
+package cat
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// errThrottled is returned when a request to the providers can't be made within the rate limit
+var errThrottled = fmt.Errorf("%w: too many requests, not waiting any longer", errTransient)
+
+// rateLimiter bounds the rate of the requests made to the providers by all the
+// cat requests, as the clowder is shared.
+type rateLimiter struct {
+	lock    sync.Mutex
+	limiter *rate.Limiter
+	wait    time.Duration
+}
+
+// configure sets the requests per second and burst, a zero limit disables the
+// rate limit, and the longest a request waits for its turn.
+func (l *rateLimiter) configure(limit float64, burst int, wait time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.wait = wait
+	switch {
+	case limit <= 0:
+		l.limiter = nil
+	case l.limiter == nil:
+		l.limiter = rate.NewLimiter(rate.Limit(limit), burst)
+	default:
+		// keep the tokens already taken
+		l.limiter.SetLimit(rate.Limit(limit))
+		l.limiter.SetBurst(burst)
+	}
+}
+
+// take waits for the turn of a request, failing with errThrottled when it
+// would take longer than the configured wait. Without a wait the request only
+// goes ahead if it is its turn already.
+func (l *rateLimiter) take(ctx context.Context) error {
+	l.lock.Lock()
+	limiter, wait := l.limiter, l.wait
+	l.lock.Unlock()
+	if limiter == nil {
+		return nil
+	}
+	if wait <= 0 {
+		if !limiter.Allow() {
+			return errThrottled
+		}
+		return nil
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	if err := limiter.Wait(waitCtx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return errThrottled
+	}
+	return nil
+}
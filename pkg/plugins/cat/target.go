@@ -0,0 +1,32 @@
+package cat
+
+import (
+	"fmt"
+
+	"github.com/jenkins-x/lighthouse/pkg/scmprovider"
+)
+
+// Target is the issue or PR the cats are posted to
+type Target struct {
+	Org    string
+	Repo   string
+	Number int
+	IsPR   bool
+	// ThreadID is the discussion replied to, empty for top level comments
+	ThreadID string
+}
+
+// replyTarget is the issue or PR of the command, in the thread it was typed in
+func replyTarget(e *scmprovider.GenericCommentEvent) Target {
+	return Target{
+		Org:      e.Repo.Namespace,
+		Repo:     e.Repo.Name,
+		Number:   e.Number,
+		IsPR:     e.IsPR,
+		ThreadID: e.ThreadID,
+	}
+}
+
+func (t Target) String() string {
+	return fmt.Sprintf("%s/%s#%d", t.Org, t.Repo, t.Number)
+}
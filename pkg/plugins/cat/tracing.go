@@ -0,0 +1,41 @@
+package cat
+
+import (
+	"context"
+
+	"go.opencensus.io/trace"
+)
+
+// tracedReadCat reads cats from the clowder in a span with the request and
+// its outcome, as counted by the metrics. The spans are children of the span
+// in the context, if any, and are recorded by the OpenCensus exporters of the
+// process, none by default.
+func tracedReadCat(ctx context.Context, c Clowder, category string, movieCat bool, maxSize, count int) (string, error) {
+	ctx, span := trace.StartSpan(ctx, "cat.ReadCat")
+	defer span.End()
+	span.AddAttributes(
+		trace.StringAttribute("cat.category", category),
+		trace.BoolAttribute("cat.movie", movieCat),
+		trace.Int64Attribute("cat.count", int64(count)),
+	)
+	resp, err := c.ReadCat(ctx, category, movieCat, maxSize, count)
+	span.AddAttributes(trace.StringAttribute("cat.outcome", outcome(err)))
+	return resp, err
+}
+
+// tracedComment creates the comment on the target in a span, retries included
+func tracedComment(ctx context.Context, to Target, create func() error) error {
+	_, span := trace.StartSpan(ctx, "cat.CreateComment")
+	defer span.End()
+	span.AddAttributes(trace.StringAttribute("cat.target", to.String()))
+	err := create()
+	span.AddAttributes(trace.StringAttribute("cat.outcome", commentOutcome(err)))
+	return err
+}
+
+func commentOutcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return outcomeSuccess
+}
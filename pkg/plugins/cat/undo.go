@@ -0,0 +1,106 @@
+package cat
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/lighthouse/pkg/plugins"
+	"github.com/jenkins-x/lighthouse/pkg/scmprovider"
+	"github.com/sirupsen/logrus"
+)
+
+// noCatToUndoMessage is the reply to /meow undo when the bot left no cat
+const noCatToUndoMessage = "There is no cat to undo here."
+
+// undoRoles are the permissions letting a user undo the cat someone else summoned
+var undoRoles = []string{scmprovider.RoleAdmin, scmprovider.RoleMaintainer}
+
+// summonerMarker records who summoned the cat, for /meow undo
+var summonerMarker = regexp.MustCompile(`<!-- lighthouse-cat-summoner: (\S+) -->`)
+
+// isUndoCommand returns true for the argument asking to remove the last cat
+func isUndoCommand(arg string) bool {
+	return strings.EqualFold(strings.TrimSpace(arg), "undo")
+}
+
+// summonedBy is the hidden marker of the user who summoned a cat, empty for
+// cats without a known summoner
+func summonedBy(login string) string {
+	if login == "" {
+		return ""
+	}
+	return fmt.Sprintf("\n<!-- lighthouse-cat-summoner: %s -->", login)
+}
+
+// summonerOf returns the user who summoned the cat of the comment. The marker
+// of the bot is the last one, after the quoted command which may hold others.
+func summonerOf(body string) string {
+	if m := summonerMarker.FindAllStringSubmatch(body, -1); m != nil {
+		return m[len(m)-1][1]
+	}
+	return ""
+}
+
+// lastCat returns the most recent cat comment left by the bot, nil if none
+func lastCat(spc SCMProviderClient, org, repo string, number int, pr bool) (*scm.Comment, error) {
+	botName, err := spc.BotName()
+	if err != nil {
+		return nil, err
+	}
+	var comments []*scm.Comment
+	if pr {
+		comments, err = spc.ListPullRequestComments(org, repo, number)
+	} else {
+		comments, err = spc.ListIssueComments(org, repo, number)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list comments: %w", err)
+	}
+	for i := len(comments) - 1; i >= 0; i-- {
+		if comments[i].Author.Login == botName && strings.Contains(comments[i].Body, catMarker) {
+			return comments[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// handleUndo deletes the last cat posted on the issue or PR, when asked by the
+// user who summoned it or by a maintainer of the repo
+func handleUndo(format plugins.ResponseFormatter, spc SCMProviderClient, log *logrus.Entry, e *scmprovider.GenericCommentEvent) error {
+	org := e.Repo.Namespace
+	repo := e.Repo.Name
+	if format == nil {
+		format = plugins.FormatResponseRaw
+	}
+	reply := func(msg string) error {
+		return spc.CreateCommentReply(org, repo, e.Number, e.IsPR, e.ThreadID, format(e.Body, e.Link, spc.QuoteAuthorForComment(e.AuthorMention()), msg))
+	}
+	comment, err := lastCat(spc, org, repo, e.Number, e.IsPR)
+	if err != nil {
+		return err
+	}
+	if comment == nil {
+		return reply(noCatToUndoMessage)
+	}
+	if by := summonerOf(comment.Body); by == "" || by != e.Author.Login {
+		maintainer, err := spc.HasPermission(org, repo, e.Author.Login, undoRoles...)
+		if err != nil {
+			return fmt.Errorf("error in HasPermission(%s/%s): %v", org, repo, err)
+		}
+		if !maintainer {
+			log.Infof("Ignoring cat undo from %s who neither summoned the cat nor maintains %s/%s", e.Author.Login, org, repo)
+			msg := "Sorry, only a maintainer can undo this cat."
+			if by != "" {
+				msg = fmt.Sprintf("Sorry, only %s or a maintainer can undo this cat.", spc.QuoteAuthorForComment(by))
+			}
+			return reply(msg)
+		}
+	}
+	if err := spc.DeleteComment(org, repo, e.Number, comment.ID, e.IsPR); err != nil {
+		return fmt.Errorf("failed to delete the cat comment %d: %w", comment.ID, err)
+	}
+	log.WithField("comment", comment.ID).Infof("Deleted the cat at the request of %s", e.Author.Login)
+	return nil
+}
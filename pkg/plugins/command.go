@@ -4,12 +4,128 @@ import (
 	"errors"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/jenkins-x/go-scm/scm"
 	"github.com/jenkins-x/lighthouse/pkg/pluginhelp"
 	"github.com/jenkins-x/lighthouse/pkg/scmprovider"
+	"github.com/sirupsen/logrus"
+	"k8s.io/utils/clock"
 )
 
+// cooldowns remembers the commands that were invoked recently
+var cooldowns = &CooldownTracker{}
+
+// minCooldownSweep is the number of keys a CooldownTracker holds before it
+// first sweeps the keys that cooled down
+const minCooldownSweep = 128
+
+// CooldownTracker remembers the keys that were used recently, e.g. a command
+// of a user in a repo, so that they are skipped until they cool down.
+type CooldownTracker struct {
+	lock  sync.Mutex
+	until map[string]time.Time
+	// sweepAt is the number of keys at which the cooled down ones are swept
+	sweepAt int
+}
+
+// Allow returns false while the key is cooling down, otherwise the key starts
+// cooling down for the given duration. Only the key is looked at, the keys
+// that cooled down are swept once the tracker doubled in size since the last
+// sweep.
+func (t *CooldownTracker) Allow(key string, cooldown time.Duration, now time.Time) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.until == nil {
+		t.until = map[string]time.Time{}
+	}
+	if until, ok := t.until[key]; ok && now.Before(until) {
+		return false
+	}
+	t.until[key] = now.Add(cooldown)
+	if len(t.until) >= t.sweepAt {
+		t.sweep(now)
+	}
+	return true
+}
+
+// sweep forgets the keys that cooled down
+func (t *CooldownTracker) sweep(now time.Time) {
+	for k, until := range t.until {
+		if !now.Before(until) {
+			delete(t.until, k)
+		}
+	}
+	t.sweepAt = 2 * len(t.until)
+	if t.sweepAt < minCooldownSweep {
+		t.sweepAt = minCooldownSweep
+	}
+}
+
+// Len returns the number of keys the tracker remembers, cooled down or not
+func (t *CooldownTracker) Len() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.until)
+}
+
+// maxTrackedComments bounds the number of comments remembered for edits
+const maxTrackedComments = 1000
+
+// comments remembers the commands deduping edits last seen in each comment, the
+// least recently seen comments are forgotten first
+var comments = newCommentTracker(maxTrackedComments)
+
+// newCommentTracker remembers up to size comments, it panics if size is not
+// positive
+func newCommentTracker(size int) *lru.Cache {
+	cache, err := lru.New(size)
+	if err != nil {
+		panic(err)
+	}
+	return cache
+}
+
+// FillPreviousBody remembers the commands of the comment which dedupe edits so
+// that, when the comment is later edited and the provider doesn't send the
+// previous body, the commands it had are filled in as the previous body, one
+// per line. Comments are only remembered in repos where the plugins have such
+// commands.
+func FillPreviousBody(ce *scmprovider.GenericCommentEvent, plugins map[string]Plugin) {
+	if ce.Link == "" {
+		return
+	}
+	dedupes := false
+	var commands []string
+	for _, p := range plugins {
+		for _, cmd := range p.Commands {
+			if !cmd.DedupeEdits {
+				continue
+			}
+			dedupes = true
+			for _, m := range cmd.GetRegex().FindAllString(ce.Body, -1) {
+				commands = append(commands, strings.TrimSpace(m))
+			}
+		}
+	}
+	if !dedupes {
+		return
+	}
+	if ce.Action == scm.ActionEdited && ce.PreviousBody == "" {
+		if previous, ok := comments.Get(ce.Link); ok {
+			ce.PreviousBody = previous.(string)
+		}
+	}
+	if ce.Action == scm.ActionDelete {
+		comments.Remove(ce.Link)
+		return
+	}
+	// the trailing newline tells a comment without commands from an unknown one
+	comments.Add(ce.Link, strings.Join(commands, "\n")+"\n")
+}
+
 // CommandArg defines a plugin command argument
 type CommandArg struct {
 	Usage    string
@@ -50,6 +166,9 @@ type CommandMatch struct {
 	Prefix string
 	Name   string
 	Arg    string
+	// Captures holds the named groups of the argument pattern that matched,
+	// e.g. `breed=(?P<breed>\S+)` gives Captures["breed"]
+	Captures map[string]string
 }
 
 // CommandInvoker defines a plugin command handler and the condition needed for the handler to be invoked
@@ -154,6 +273,20 @@ type Command struct {
 	Featured    bool
 	WhoCanUse   string
 	MaxMatches  int
+	// Cooldown, when set, returns the minimum time between invocations of the
+	// command by the same user in the same repo, e.g. from the configuration of
+	// the plugin for the repo, invocations during the cooldown are skipped.
+	// Invocations it returns zero for don't cool down.
+	Cooldown func(CommandMatch, Agent, scmprovider.GenericCommentEvent) time.Duration
+	// OnCooldown, when set, handles the invocations skipped during the cooldown
+	// instead, e.g. to let the user know the command was seen.
+	OnCooldown CommandEventHandler
+	// Clock tells the time of the cooldown, defaults to the real clock
+	Clock clock.PassiveClock
+	// DedupeEdits only runs the matches that were added by an edit, matches
+	// already in the previous body are skipped. Edits are skipped altogether
+	// when the previous body isn't known.
+	DedupeEdits bool
 	Action      CommandInvoker
 	regex       *regexp.Regexp
 }
@@ -163,14 +296,24 @@ func (cmd Command) InvokeCommandHandler(ce *scmprovider.GenericCommentEvent, han
 	if cmd.Action.Handler == nil || (cmd.Action.Condition != nil && !cmd.Action.Condition(*ce)) {
 		return nil
 	}
+	if cmd.DedupeEdits && ce.Action == scm.ActionEdited && ce.PreviousBody == "" {
+		return nil
+	}
 	regex := cmd.GetRegex()
 	if regex != nil {
 		max := cmd.MaxMatches
 		if max == 0 {
 			max = -1
 		}
+		previous := cmd.previousMatches(ce)
 		for _, m := range regex.FindAllStringSubmatch(ce.Body, max) {
-			if err := handler(cmd.Action.Handler, ce, cmd.createMatch(m)); err != nil {
+			if previous != nil {
+				if key := matchKey(m); previous[key] > 0 {
+					previous[key]--
+					continue
+				}
+			}
+			if err := handler(cmd.handler(), ce, cmd.createMatch(m)); err != nil {
 				return err
 			}
 		}
@@ -179,6 +322,64 @@ func (cmd Command) InvokeCommandHandler(ce *scmprovider.GenericCommentEvent, han
 	return errors.New("command must have a regexp configured")
 }
 
+// InvokeCommandHandlerFor is InvokeCommandHandler counting the matches of the
+// plugin's command before they are handled, e.g. meow and meowvie for the cat.
+func (cmd Command) InvokeCommandHandlerFor(plugin string, ce *scmprovider.GenericCommentEvent, handler func(CommandEventHandler, *scmprovider.GenericCommentEvent, CommandMatch) error) error {
+	return cmd.InvokeCommandHandler(ce, func(h CommandEventHandler, e *scmprovider.GenericCommentEvent, match CommandMatch) error {
+		commandCounter.WithLabelValues(plugin, strings.ToLower(match.Name), e.Action.String()).Inc()
+		return handler(h, e, match)
+	})
+}
+
+// previousMatches counts the matches already in the body before an edit when
+// the command dedupes edits, nil otherwise.
+func (cmd *Command) previousMatches(ce *scmprovider.GenericCommentEvent) map[string]int {
+	if !cmd.DedupeEdits || ce.Action != scm.ActionEdited {
+		return nil
+	}
+	previous := map[string]int{}
+	for _, m := range cmd.GetRegex().FindAllStringSubmatch(ce.PreviousBody, -1) {
+		previous[matchKey(m)]++
+	}
+	return previous
+}
+
+func matchKey(m []string) string {
+	return strings.ToLower(strings.TrimSpace(m[0]))
+}
+
+// handler returns the handler of the command's action, skipping the
+// invocations during the cooldown when the command has one.
+func (cmd Command) handler() CommandEventHandler {
+	if cmd.Cooldown == nil {
+		return cmd.Action.Handler
+	}
+	return func(match CommandMatch, pc Agent, e scmprovider.GenericCommentEvent) error {
+		if cmd.allow(cmd.Cooldown(match, pc, e), &e) {
+			return cmd.Action.Handler(match, pc, e)
+		}
+		logrus.WithFields(logrus.Fields{"command": cmd.Name, "user": e.Author.Login, "repo": e.Repo.FullName}).Info("Skipping command on cooldown")
+		if cmd.OnCooldown == nil {
+			return nil
+		}
+		return cmd.OnCooldown(match, pc, e)
+	}
+}
+
+// allow checks the cooldown of the command for the author of the event, events
+// without an author can't be told apart so they are never skipped.
+func (cmd Command) allow(cooldown time.Duration, ce *scmprovider.GenericCommentEvent) bool {
+	if cooldown <= 0 || ce.Author.Login == "" {
+		return true
+	}
+	c := cmd.Clock
+	if c == nil {
+		c = clock.RealClock{}
+	}
+	key := strings.Join([]string{cmd.Prefix, cmd.Name, ce.Author.Login, ce.Repo.Namespace, ce.Repo.Name}, "/")
+	return cooldowns.Allow(key, cooldown, c.Now())
+}
+
 // GetRegex creates the regular expression from a command syntax
 func (cmd *Command) GetRegex() *regexp.Regexp {
 	if cmd.regex != nil {
@@ -268,5 +469,14 @@ func (cmd Command) createMatch(matches []string) CommandMatch {
 			match.Arg = matches[2]
 		}
 	}
+	for i, name := range cmd.GetRegex().SubexpNames() {
+		if name == "" || matches[i] == "" {
+			continue
+		}
+		if match.Captures == nil {
+			match.Captures = map[string]string{}
+		}
+		match.Captures[name] = matches[i]
+	}
 	return match
 }
@@ -1,11 +1,17 @@
 package plugins_test
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/jenkins-x/go-scm/scm"
 	"github.com/jenkins-x/lighthouse/pkg/pluginhelp"
 	"github.com/jenkins-x/lighthouse/pkg/plugins"
+	"github.com/jenkins-x/lighthouse/pkg/scmprovider"
+	"github.com/prometheus/client_golang/prometheus"
+	clocktesting "k8s.io/utils/clock/testing"
 )
 
 func TestCommandArgGetRegex(t *testing.T) {
@@ -416,6 +422,59 @@ func TestCommandGetMatches(t *testing.T) {
 			},
 			content: "/build foo",
 		},
+		{
+			name: "named captures",
+			command: plugins.Command{
+				Name: "test",
+				Arg: &plugins.CommandArg{
+					Pattern:  `(?:(?:breed=(?P<breed>\S+)|count=(?P<count>\d+)|\S+)(?:[ \t]+|$))+`,
+					Optional: true,
+				},
+			},
+			content: "/test count=2 breed=bengal",
+			expected: []plugins.CommandMatch{{
+				Name: "test",
+				Arg:  "count=2 breed=bengal",
+				Captures: map[string]string{
+					"breed": "bengal",
+					"count": "2",
+				},
+			}},
+		},
+		{
+			name: "named captures, only some match",
+			command: plugins.Command{
+				Prefix: "prefix-",
+				Name:   "test",
+				Arg: &plugins.CommandArg{
+					Pattern: `(?:(?:breed=(?P<breed>\S+)|count=(?P<count>\d+)|\S+)(?:[ \t]+|$))+`,
+				},
+			},
+			content: "/prefix-test gif breed=bengal",
+			expected: []plugins.CommandMatch{{
+				Prefix: "prefix-",
+				Name:   "test",
+				Arg:    "gif breed=bengal",
+				Captures: map[string]string{
+					"breed": "bengal",
+				},
+			}},
+		},
+		{
+			name: "named captures, none match",
+			command: plugins.Command{
+				Name: "test",
+				Arg: &plugins.CommandArg{
+					Pattern:  `(?P<word>foo)?.*`,
+					Optional: true,
+				},
+			},
+			content: "/test bar",
+			expected: []plugins.CommandMatch{{
+				Name: "test",
+				Arg:  "bar",
+			}},
+		},
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -669,3 +728,332 @@ func TestCommandGetHelp(t *testing.T) {
 		})
 	}
 }
+
+func TestCommandCooldown(t *testing.T) {
+	calls := 0
+	clock := clocktesting.NewFakePassiveClock(time.Date(2024, time.May, 6, 9, 0, 0, 0, time.UTC))
+	cmd := plugins.Command{
+		Name:     "cooldown-test",
+		Cooldown: cooldown(time.Hour),
+		Clock:    clock,
+		Action: plugins.Invoke(func(plugins.CommandMatch, plugins.Agent, scmprovider.GenericCommentEvent) error {
+			calls++
+			return nil
+		}),
+	}
+	invoke := func(user, repo string) {
+		e := &scmprovider.GenericCommentEvent{
+			Body:   "/cooldown-test",
+			Author: scm.User{Login: user},
+			Repo:   scm.Repository{Namespace: "org", Name: repo},
+		}
+		if err := cmd.InvokeCommandHandler(e, func(h plugins.CommandEventHandler, e *scmprovider.GenericCommentEvent, match plugins.CommandMatch) error {
+			return h(match, plugins.Agent{}, *e)
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	invoke("alice", "repo")
+	invoke("alice", "repo")
+	if calls != 1 {
+		t.Errorf("expected rapid invocations to run the action once, got %d", calls)
+	}
+	invoke("bob", "repo")
+	invoke("alice", "other")
+	if calls != 3 {
+		t.Errorf("expected other users and repos to have their own cooldown, got %d calls", calls)
+	}
+	invoke("", "repo")
+	invoke("", "repo")
+	if calls != 5 {
+		t.Errorf("expected events without an author not to be throttled, got %d calls", calls)
+	}
+	clock.SetTime(clock.Now().Add(time.Hour))
+	invoke("alice", "repo")
+	if calls != 6 {
+		t.Errorf("expected the action to run again once cooled down, got %d calls", calls)
+	}
+}
+
+func TestCommandCooldownFromConfig(t *testing.T) {
+	calls := 0
+	cmd := plugins.Command{
+		Name: "config-cooldown-test",
+		Cooldown: func(match plugins.CommandMatch, pc plugins.Agent, e scmprovider.GenericCommentEvent) time.Duration {
+			if match.Arg == "help" {
+				return 0
+			}
+			return pc.PluginConfig.Cat.CooldownDuration
+		},
+		Arg: &plugins.CommandArg{Pattern: "help", Optional: true},
+		Action: plugins.Invoke(func(plugins.CommandMatch, plugins.Agent, scmprovider.GenericCommentEvent) error {
+			calls++
+			return nil
+		}),
+	}
+	agent := plugins.Agent{PluginConfig: &plugins.Configuration{Cat: plugins.Cat{CooldownDuration: time.Hour}}}
+	for _, body := range []string{"/config-cooldown-test", "/config-cooldown-test", "/config-cooldown-test help", "/config-cooldown-test help"} {
+		e := &scmprovider.GenericCommentEvent{
+			Body:   body,
+			Author: scm.User{Login: "alice"},
+			Repo:   scm.Repository{Namespace: "org", Name: "repo"},
+		}
+		if err := cmd.InvokeCommandHandler(e, func(h plugins.CommandEventHandler, e *scmprovider.GenericCommentEvent, match plugins.CommandMatch) error {
+			return h(match, agent, *e)
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("expected the configured cooldown to skip the second invocation only, got %d calls", calls)
+	}
+}
+
+// cooldown is a fixed cooldown for every invocation of a command
+func cooldown(d time.Duration) func(plugins.CommandMatch, plugins.Agent, scmprovider.GenericCommentEvent) time.Duration {
+	return func(plugins.CommandMatch, plugins.Agent, scmprovider.GenericCommentEvent) time.Duration {
+		return d
+	}
+}
+
+func TestCooldownTracker(t *testing.T) {
+	tracker := &plugins.CooldownTracker{}
+	now := time.Date(2024, time.May, 6, 9, 0, 0, 0, time.UTC)
+	if !tracker.Allow("key", time.Minute, now) {
+		t.Error("expected the first use to be allowed")
+	}
+	if tracker.Allow("key", time.Minute, now.Add(59*time.Second)) {
+		t.Error("expected the key to cool down for a minute")
+	}
+	if !tracker.Allow("other", time.Minute, now) {
+		t.Error("expected the other keys to have their own cooldown")
+	}
+	if !tracker.Allow("key", time.Minute, now.Add(time.Minute)) {
+		t.Error("expected the key to be allowed again once cooled down")
+	}
+}
+
+func TestCooldownTrackerSweep(t *testing.T) {
+	tracker := &plugins.CooldownTracker{}
+	now := time.Date(2024, time.May, 6, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		tracker.Allow(fmt.Sprintf("old-%d", i), time.Minute, now)
+	}
+	if n := tracker.Len(); n != 100 {
+		t.Fatalf("expected the keys to be kept until the tracker grows, got %d", n)
+	}
+	later := now.Add(time.Hour)
+	for i := 0; i < 200; i++ {
+		tracker.Allow(fmt.Sprintf("new-%d", i), time.Minute, later)
+	}
+	if n := tracker.Len(); n > 200 {
+		t.Errorf("expected the cooled down keys to be swept, got %d keys", n)
+	}
+	if tracker.Allow("new-0", time.Minute, later) {
+		t.Error("expected the keys still cooling down to be kept by the sweep")
+	}
+}
+
+func TestCommandOnCooldown(t *testing.T) {
+	var actions, cooldowns int
+	cmd := plugins.Command{
+		Name:     "on-cooldown-test",
+		Cooldown: cooldown(time.Hour),
+		Action: plugins.Invoke(func(plugins.CommandMatch, plugins.Agent, scmprovider.GenericCommentEvent) error {
+			actions++
+			return nil
+		}),
+		OnCooldown: func(plugins.CommandMatch, plugins.Agent, scmprovider.GenericCommentEvent) error {
+			cooldowns++
+			return nil
+		},
+	}
+	for i := 0; i < 3; i++ {
+		e := &scmprovider.GenericCommentEvent{
+			Body:   "/on-cooldown-test",
+			Author: scm.User{Login: "alice"},
+			Repo:   scm.Repository{Namespace: "org", Name: "repo"},
+		}
+		if err := cmd.InvokeCommandHandler(e, func(h plugins.CommandEventHandler, e *scmprovider.GenericCommentEvent, match plugins.CommandMatch) error {
+			return h(match, plugins.Agent{}, *e)
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if actions != 1 || cooldowns != 2 {
+		t.Errorf("expected 1 action and 2 cooldown calls, got %d and %d", actions, cooldowns)
+	}
+}
+
+func TestCommandDedupeEdits(t *testing.T) {
+	cmd := plugins.Command{
+		Name:        "dedupe-test",
+		DedupeEdits: true,
+		Action: plugins.Invoke(func(plugins.CommandMatch, plugins.Agent, scmprovider.GenericCommentEvent) error {
+			return nil
+		}),
+	}
+	cases := []struct {
+		name     string
+		action   scm.Action
+		previous string
+		body     string
+		expected int
+	}{
+		{
+			name:     "created comment fires",
+			action:   scm.ActionCreate,
+			body:     "/dedupe-test",
+			expected: 1,
+		},
+		{
+			name:     "added command on edit fires",
+			action:   scm.ActionEdited,
+			previous: "looks good",
+			body:     "looks good\n/dedupe-test",
+			expected: 1,
+		},
+		{
+			name:     "unchanged command on edit does not fire",
+			action:   scm.ActionEdited,
+			previous: "/dedupe-test",
+			body:     "/dedupe-test\nfixed a typo",
+			expected: 0,
+		},
+		{
+			name:     "second copy of the command on edit fires once",
+			action:   scm.ActionEdited,
+			previous: "/dedupe-test",
+			body:     "/dedupe-test\n/DEDUPE-TEST",
+			expected: 1,
+		},
+		{
+			name:     "edit without the previous body does not fire",
+			action:   scm.ActionEdited,
+			body:     "/dedupe-test",
+			expected: 0,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			e := &scmprovider.GenericCommentEvent{
+				Action:       tc.action,
+				Body:         tc.body,
+				PreviousBody: tc.previous,
+			}
+			if err := cmd.InvokeCommandHandler(e, func(plugins.CommandEventHandler, *scmprovider.GenericCommentEvent, plugins.CommandMatch) error {
+				calls++
+				return nil
+			}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if calls != tc.expected {
+				t.Errorf("expected %d calls, got %d", tc.expected, calls)
+			}
+		})
+	}
+}
+
+func TestFillPreviousBody(t *testing.T) {
+	cmd := plugins.Command{
+		Name:        "fill-test",
+		DedupeEdits: true,
+		Action: plugins.Invoke(func(plugins.CommandMatch, plugins.Agent, scmprovider.GenericCommentEvent) error {
+			return nil
+		}),
+	}
+	dedupes := map[string]plugins.Plugin{"fill": {Commands: []plugins.Command{cmd}}}
+	link := "https://example.com/org/repo/issues/1#comment-fill"
+	created := &scmprovider.GenericCommentEvent{Action: scm.ActionCreate, Link: link, Body: "first\n/fill-test  \nthanks"}
+	plugins.FillPreviousBody(created, dedupes)
+	if created.PreviousBody != "" {
+		t.Errorf("expected no previous body for a created comment, got %q", created.PreviousBody)
+	}
+	edited := &scmprovider.GenericCommentEvent{Action: scm.ActionEdited, Link: link, Body: "second"}
+	plugins.FillPreviousBody(edited, dedupes)
+	if edited.PreviousBody != "/fill-test\n" {
+		t.Errorf("expected the commands of the previous body, got %q", edited.PreviousBody)
+	}
+	none := &scmprovider.GenericCommentEvent{Action: scm.ActionEdited, Link: link, Body: "third\n/fill-test"}
+	plugins.FillPreviousBody(none, dedupes)
+	if none.PreviousBody == "" {
+		t.Error("expected a previous body without commands to be known")
+	}
+	calls := 0
+	if err := cmd.InvokeCommandHandler(none, func(plugins.CommandEventHandler, *scmprovider.GenericCommentEvent, plugins.CommandMatch) error {
+		calls++
+		return nil
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected the command added by the edit to fire, got %d calls", calls)
+	}
+	sent := &scmprovider.GenericCommentEvent{Action: scm.ActionEdited, Link: link, Body: "fourth", PreviousBody: "from provider"}
+	plugins.FillPreviousBody(sent, dedupes)
+	if sent.PreviousBody != "from provider" {
+		t.Errorf("expected the provider's previous body to be kept, got %q", sent.PreviousBody)
+	}
+	plugins.FillPreviousBody(&scmprovider.GenericCommentEvent{Action: scm.ActionDelete, Link: link}, dedupes)
+	again := &scmprovider.GenericCommentEvent{Action: scm.ActionEdited, Link: link, Body: "fifth"}
+	plugins.FillPreviousBody(again, dedupes)
+	if again.PreviousBody != "" {
+		t.Errorf("expected deleted comments to be forgotten, got %q", again.PreviousBody)
+	}
+
+	// repos without commands deduping edits don't have their comments remembered
+	other := "https://example.com/org/other/issues/1#comment-fill"
+	plain := map[string]plugins.Plugin{"plain": {Commands: []plugins.Command{{Name: "fill-test"}}}}
+	plugins.FillPreviousBody(&scmprovider.GenericCommentEvent{Action: scm.ActionCreate, Link: other, Body: "/fill-test"}, plain)
+	later := &scmprovider.GenericCommentEvent{Action: scm.ActionEdited, Link: other, Body: "/fill-test"}
+	plugins.FillPreviousBody(later, dedupes)
+	if later.PreviousBody != "" {
+		t.Errorf("expected the comment not to be remembered, got %q", later.PreviousBody)
+	}
+}
+
+func TestCommandMetrics(t *testing.T) {
+	cmd := plugins.Command{
+		Name: "metrics-test|metrics-movie",
+		Action: plugins.Invoke(func(plugins.CommandMatch, plugins.Agent, scmprovider.GenericCommentEvent) error {
+			return nil
+		}),
+	}
+	e := &scmprovider.GenericCommentEvent{
+		Action: scm.ActionCreate,
+		Body:   "/metrics-test\n/metrics-movie\n/METRICS-TEST",
+		Author: scm.User{Login: "alice"},
+		Repo:   scm.Repository{Namespace: "org", Name: "repo"},
+	}
+	if err := cmd.InvokeCommandHandlerFor("metrics", e, func(plugins.CommandEventHandler, *scmprovider.GenericCommentEvent, plugins.CommandMatch) error {
+		return nil
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather the metrics: %v", err)
+	}
+	counts := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "lighthouse_plugin_commands_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["plugin"] == "metrics" {
+				counts[labels["command"]+"/"+labels["action"]] = m.GetCounter().GetValue()
+			}
+		}
+	}
+	expected := map[string]float64{"metrics-test/created": 2, "metrics-movie/created": 1}
+	if !reflect.DeepEqual(expected, counts) {
+		t.Errorf("expected command counts %v, got %v", expected, counts)
+	}
+}
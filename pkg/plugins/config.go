@@ -19,10 +19,14 @@ package plugins
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"os"
 	"path"
 	"regexp"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/jenkins-x/lighthouse/pkg/labels"
@@ -50,6 +54,11 @@ type Configuration struct {
 	// Owners contains configuration related to handling OWNERS files.
 	Owners Owners `json:"owners,omitempty"`
 
+	// ResponseTemplate is a Go template used to wrap the replies of plugins
+	// instead of the default format, see ResponseData for the fields available.
+	ResponseTemplate string             `json:"response_template,omitempty"`
+	ResponseTmpl     *template.Template `json:"-"`
+
 	// Built-in plugins specific configuration.
 	Approve              []Approve              `json:"approve,omitempty"`
 	Blockades            []Blockade             `json:"blockades,omitempty"`
@@ -210,6 +219,8 @@ var (
 	warnImplicitSelfApprove time.Time
 	warnReviewActsAsApprove time.Time
 	warnLock                sync.RWMutex // Rare updates and concurrent readers, so reuse the same lock
+	// warnedCatKeyPath is the unreadable cat key path last warned about
+	warnedCatKeyPath string
 )
 
 func warnDeprecated(last *time.Time, freq time.Duration, msg string) {
@@ -276,8 +287,551 @@ type Lgtm struct {
 
 // Cat contains the configuration for the cat plugin.
 type Cat struct {
-	// Path to file containing an api key for thecatapi.com
+	// Path to file containing an api key for thecatapi.com, a file that can't be
+	// read is warned about when the configuration is loaded.
 	KeyPath string `json:"key_path,omitempty"`
+	// KeySecret is a namespace/name/key reference to a kubernetes secret containing
+	// the api key for thecatapi.com. It takes precedence over KeyPath.
+	KeySecret string `json:"key_secret,omitempty"`
+	// KeyReloadInterval is the minimum time between reloads of the api key.
+	// Defaults to '1m'.
+	KeyReloadInterval         string        `json:"key_reload_interval,omitempty"`
+	KeyReloadIntervalDuration time.Duration `json:"-"`
+	// MaxImageSizeBytes is the largest image size in bytes that will be posted.
+	// Defaults to the GitHub limit of 10MB when unset.
+	MaxImageSizeBytes int `json:"max_image_size_bytes,omitempty"`
+	// AllowBigOverride lets `/meow big` ask for images up to BigImageSizeBytes
+	// instead of MaxImageSizeBytes, e.g. on GitLab instances allowing large
+	// attachments. The override is ignored when unset.
+	AllowBigOverride bool `json:"allow_big_override,omitempty"`
+	// BigImageSizeBytes is the largest image size in bytes posted for `/meow big`.
+	// Defaults to 100MB, the GitLab attachment limit.
+	BigImageSizeBytes int `json:"big_image_size_bytes,omitempty"`
+	// MaxWidth and MaxHeight are the largest dimensions in pixels of the images
+	// posted, for providers that give them. Zero doesn't limit them.
+	MaxWidth  int `json:"max_width,omitempty"`
+	MaxHeight int `json:"max_height,omitempty"`
+	// MaxGifFrames skips the gifs with more frames, as given by the provider or
+	// else counted in the gif. Zero doesn't limit them.
+	MaxGifFrames int `json:"max_gif_frames,omitempty"`
+	// AllowedImageHosts are the only hosts, with their subdomains, that images are
+	// posted from. Any host is allowed when empty. The host of the grumpy cat
+	// image is allowed as long as the grumpy cat isn't disabled.
+	AllowedImageHosts []string `json:"allowed_image_hosts,omitempty"`
+	// PostResolvedURL posts the url the image was found at once its redirects
+	// were followed, e.g. to a CDN, instead of the url given by the provider, so
+	// that the image rendered is the one whose size was checked.
+	PostResolvedURL bool `json:"post_resolved_url,omitempty"`
+	// RequireHTTPS only posts the images the providers find over https, as some
+	// hosts reject the others, e.g. GitHub proxies the images of comments through
+	// camo. An http image is turned down and another looked for unless UpgradeHTTP
+	// is set.
+	// Defaults to true.
+	RequireHTTPS *bool `json:"require_https,omitempty"`
+	// UpgradeHTTP posts the http images over https rather than turning them down
+	// with RequireHTTPS.
+	UpgradeHTTP bool `json:"upgrade_http,omitempty"`
+	// ImageSizeStrategy is how the size of an image is found: 'head' uses the
+	// Content-Length of a HEAD request and 'range' asks for the first byte of the
+	// image, for CDNs that don't send a Content-Length. Either falls back to the
+	// other when it can't tell the size.
+	// Defaults to 'head'.
+	ImageSizeStrategy string `json:"image_size_strategy,omitempty"`
+	// Retries is the number of attempts made to fetch a cat image, and then to post
+	// it, before giving up.
+	// Defaults to 3. Any value below 1 still results in a single attempt.
+	Retries *int `json:"retries,omitempty"`
+	// RetryBackoff is the delay before the second attempt, doubled for every
+	// subsequent attempt.
+	// Defaults to '500ms'.
+	RetryBackoff         string        `json:"retry_backoff,omitempty"`
+	RetryBackoffDuration time.Duration `json:"-"`
+	// MaxRetryAfter is the longest Retry-After delay of a rate limited request that
+	// will be waited for before the next attempt, longer delays give up straight away.
+	// Defaults to '10s'.
+	MaxRetryAfter         string        `json:"max_retry_after,omitempty"`
+	MaxRetryAfterDuration time.Duration `json:"-"`
+	// RetryableStatusCodes are the response statuses of the cat providers that
+	// are asked again, any other status gives up straight away, e.g. [429] for a
+	// mirror answering 503 when it is rate limiting.
+	// Defaults to 429 and all the 5xx.
+	RetryableStatusCodes []int `json:"retryable_status_codes,omitempty"`
+	// MaxTotalTime caps the time spent looking for a cat across all the retries,
+	// once spent the fallback is posted right away.
+	// Defaults to '0s' which doesn't cap it.
+	MaxTotalTime         string        `json:"max_total_time,omitempty"`
+	MaxTotalTimeDuration time.Duration `json:"-"`
+	// RequestTimeout is the timeout for requests made to thecatapi.com.
+	// Defaults to '10s'.
+	RequestTimeout         string        `json:"request_timeout,omitempty"`
+	RequestTimeoutDuration time.Duration `json:"-"`
+	// ProxyURL is the proxy used for requests to thecatapi.com and the images it returns.
+	// The HTTP_PROXY and HTTPS_PROXY environment variables are honored when unset.
+	ProxyURL string `json:"proxy_url,omitempty"`
+	// UserAgent is the User-Agent header sent with the requests to the cat providers
+	// and the images they return, as some CDNs throttle Go's default.
+	// Defaults to 'lighthouse-cat/<version>'.
+	UserAgent string `json:"user_agent,omitempty"`
+	// APIURL is the base URL of thecatapi.com or of a mirror or compatible service,
+	// the /v1/images/search, /v1/breeds and /v1/categories paths are appended to it.
+	// Defaults to 'https://api.thecatapi.com'.
+	APIURL string `json:"api_url,omitempty"`
+	// APIVersion pins the version of the api the images are searched with: 'v1'
+	// answers with json, 'v0' is the older api of /api/images/get answering with
+	// xml. The breeds and categories are listed with v1 either way.
+	// Defaults to 'v1'.
+	APIVersion string `json:"api_version,omitempty"`
+	// Providers is an ordered list of image search URLs compatible with thecatapi.com.
+	// Each provider is tried in turn until one returns a usable image.
+	// Defaults to the search endpoint of APIURL.
+	Providers []string `json:"providers,omitempty"`
+	// ProviderWeights picks the order the providers are tried in at random for
+	// each attempt, in proportion to their weights, rather than trying them in
+	// turn, so that the load is spread and a slow provider doesn't slow every
+	// cat. Providers without a weight weigh 1 and those weighing 0 are only
+	// tried once the others failed.
+	ProviderWeights map[string]int `json:"provider_weights,omitempty"`
+	// ImagePaths maps the providers to the json path of the image urls in their
+	// responses, for providers that don't answer with a list of objects with a
+	// `url` as thecatapi.com does. The path is split on dots, numbers index into
+	// lists and `*` is each item of a list, e.g. `data.0.image.url` or `data.*.link`.
+	ImagePaths map[string]string `json:"image_paths,omitempty"`
+	// ImageFormat is the markup the cats are posted with: 'markdown' images or
+	// 'html' img tags, for providers that don't render markdown images.
+	// Defaults to 'markdown'.
+	ImageFormat string `json:"image_format,omitempty"`
+	// ProviderImageFormats maps the providers to the markup of their cats when
+	// it isn't ImageFormat, e.g. `html` for a provider whose images are posted
+	// where markdown isn't rendered.
+	ProviderImageFormats map[string]string `json:"provider_image_formats,omitempty"`
+	// LocalImageDir is a directory of images to serve when no provider can be reached,
+	// e.g. in air-gapped clusters.
+	LocalImageDir string `json:"local_image_dir,omitempty"`
+	// LocalImageURL is the externally reachable base URL of the bot, the images in
+	// LocalImageDir are served under its /cat/images/ path.
+	LocalImageURL string `json:"local_image_url,omitempty"`
+	// Offline always posts an image bundled with the bot, served under the
+	// /cat/offline/ path of LocalImageURL, without asking thecatapi.com or
+	// checking the image. Meant for demos and tests without network access.
+	Offline bool `json:"offline,omitempty"`
+	// GrumpyKeywords are the arguments which get the grumpy cat instead of asking
+	// thecatapi.com. Defaults to 'no' and 'grumpy'.
+	GrumpyKeywords []string `json:"grumpy_keywords,omitempty"`
+	// GrumpyKeywordsRe is the compiled version of GrumpyKeywords, nil when unset.
+	GrumpyKeywordsRe *regexp.Regexp `json:"-"`
+	// GrumpyStrict only gets the grumpy cat when the whole argument is a grumpy
+	// keyword. When false a keyword anywhere in the argument as a whole word is
+	// enough, e.g. 'no thanks' but not 'norwegian'. Defaults to true.
+	GrumpyStrict *bool `json:"grumpy_strict,omitempty"`
+	// GrumpyImageURL is the image posted for the grumpy keywords, it is checked
+	// as any other cat and a grumpy cat bundled with the bot, served under the
+	// /cat/offline/ path of LocalImageURL, is posted when it can't be.
+	// Defaults to the Wikimedia picture of Grumpy Cat.
+	GrumpyImageURL string `json:"grumpy_image_url,omitempty"`
+	// DisableGrumpy turns off the grumpy cat, the grumpy keywords are then asked
+	// for as any other category and GrumpyReaction is ignored.
+	DisableGrumpy bool `json:"disable_grumpy,omitempty"`
+	// UploadImages downloads the cats and uploads them to the provider, for
+	// instances where images hotlinked from elsewhere are blocked. The cats are
+	// linked as usual when the provider doesn't support uploads.
+	UploadImages bool `json:"upload_images,omitempty"`
+	// StaticFallback asks once for a still image when the gif found for /meowvie
+	// or /meow gif is too big to be posted.
+	StaticFallback bool `json:"static_fallback,omitempty"`
+	// GrumpyReaction also posts the grumpy cat when the command comment has a
+	// thumbs down reaction.
+	GrumpyReaction bool `json:"grumpy_reaction,omitempty"`
+	// AckReaction is added to the command comment when a cat request is accepted,
+	// empty adds none. GitHub only accepts +1, -1, laugh, confused, heart, hooray,
+	// rocket and eyes, GitLab accepts the names of its emoji.
+	// Defaults to 'eyes'.
+	AckReaction *string `json:"ack_reaction,omitempty"`
+	// FailureReaction is added to the command comment when no cat could be found,
+	// alongside the failure message, e.g. 'confused' or 'crying_cat_face' on GitLab.
+	// Defaults to none.
+	FailureReaction string `json:"failure_reaction,omitempty"`
+	// Cooldown is how long a user waits between cats in a repo, the cat
+	// commands sent within it are skipped. The subcommands such as
+	// `/meow categories` or `/meow undo` don't cool down, '0s' turns it off.
+	// Defaults to '5s'.
+	Cooldown         string        `json:"cooldown,omitempty"`
+	CooldownDuration time.Duration `json:"-"`
+	// CooldownReaction is added to a cat command sent again by the same user
+	// within the Cooldown, a nod to the cat just posted instead of silently
+	// skipping the command, e.g. 'eyes'.
+	// Defaults to none.
+	CooldownReaction string `json:"cooldown_reaction,omitempty"`
+	// ShowCaption adds the breed under the image when thecatapi.com knows it.
+	ShowCaption bool `json:"show_caption,omitempty"`
+	// Collapsible puts the cats in a collapsed details block so that big images
+	// don't take over the conversation, they are shown as is when unset.
+	Collapsible bool `json:"collapsible,omitempty"`
+	// PullRequests overrides how the cats are posted on pull requests, e.g.
+	// collapsed for a lighter footprint on the reviews.
+	PullRequests *CatReplies `json:"pull_requests,omitempty"`
+	// Issues overrides how the cats are posted on issues.
+	Issues *CatReplies `json:"issues,omitempty"`
+	// ReplyTmpl is the template of the replies picked by RepliesFor, nil posts
+	// the cats alone.
+	ReplyTmpl *template.Template `json:"-"`
+	// MaxCommentLength is the longest comment in bytes the provider accepts, the
+	// last cats are left out of longer replies, then the caption of the first.
+	// Defaults to 65536, the limit of GitHub.
+	MaxCommentLength int `json:"max_comment_length,omitempty"`
+	// ReplacePrevious deletes the previous cat left by the bot on an issue or PR
+	// when a new cat is posted.
+	ReplacePrevious bool `json:"replace_previous,omitempty"`
+	// HealthCheckInterval is how long the result of checking that thecatapi.com
+	// can be reached is reused for.
+	// Defaults to '5m'.
+	HealthCheckInterval         string        `json:"health_check_interval,omitempty"`
+	HealthCheckIntervalDuration time.Duration `json:"-"`
+	// BreakerThreshold is the number of consecutive failed reads from the
+	// providers after which they aren't asked again for BreakerCooldown, cat
+	// requests fail straight away in the meantime.
+	// Defaults to 5, 0 disables the circuit breaker.
+	BreakerThreshold *int `json:"breaker_threshold,omitempty"`
+	// BreakerCooldown is how long the providers are left alone once the circuit
+	// breaker opens, a single request then checks whether they recovered.
+	// Defaults to '1m'.
+	BreakerCooldown         string        `json:"breaker_cooldown,omitempty"`
+	BreakerCooldownDuration time.Duration `json:"-"`
+	// CacheTTL is how long the last cat found for a category is reused for, so
+	// that bursts of requests don't all hit the providers. A cat that was
+	// recently posted on the issue is never reused.
+	// Defaults to '0s' which disables the cache.
+	CacheTTL         string        `json:"cache_ttl,omitempty"`
+	CacheTTLDuration time.Duration `json:"-"`
+	// RateLimit is the number of requests per second made to thecatapi.com,
+	// shared by all the cat requests.
+	// Defaults to 10, 0 disables the rate limit.
+	RateLimit *float64 `json:"rate_limit,omitempty"`
+	// RateBurst is the number of requests that can be made at once within the
+	// rate limit. Defaults to twice the rate limit.
+	RateBurst int `json:"rate_burst,omitempty"`
+	// RateLimitWait is the longest a request waits for its turn within the rate
+	// limit before failing, so that it can be retried or fall back.
+	// Defaults to '1s'.
+	RateLimitWait         string        `json:"rate_limit_wait,omitempty"`
+	RateLimitWaitDuration time.Duration `json:"-"`
+	// MaxConcurrentFetches is the most cats looked for at once by all the cat
+	// requests, so that a slow thecatapi.com doesn't tie up the plugin workers.
+	// Defaults to 0, no bound.
+	MaxConcurrentFetches int `json:"max_concurrent_fetches,omitempty"`
+	// FetchQueueWait is the longest a request waits for one of the
+	// MaxConcurrentFetches to finish before being told to try again.
+	// Defaults to '1s'.
+	FetchQueueWait         string        `json:"fetch_queue_wait,omitempty"`
+	FetchQueueWaitDuration time.Duration `json:"-"`
+	// RequireMember only lets org members and repo collaborators ask for cats,
+	// anyone else is told why their command was ignored.
+	RequireMember bool `json:"require_member,omitempty"`
+	// AllowedCategories restricts the categories that can be asked for, any
+	// category is allowed when empty.
+	AllowedCategories []string `json:"allowed_categories,omitempty"`
+	// CategorySynonyms translates the informal terms users ask for into the
+	// categories asked for instead, e.g. kitten: cute. The terms match whatever
+	// their case, any other category is asked for as typed.
+	CategorySynonyms map[string]string `json:"category_synonyms,omitempty"`
+	// DefaultCategories are picked from at random, in proportion to their weights,
+	// when /meow is used without a category.
+	// Defaults to the provider's own pick of any category.
+	DefaultCategories []WeightedCategory `json:"default_categories,omitempty"`
+	// JitterFactor spreads the key reload interval and the cache ttl by up to
+	// this fraction either way, so that instances don't all hit thecatapi.com at
+	// the same time.
+	// Defaults to 0.1, 0 disables the jitter and values above 1 are treated as 1.
+	JitterFactor *float64 `json:"jitter_factor,omitempty"`
+	// Messages replaces the replies of the plugin, e.g. to translate them.
+	Messages CatMessages `json:"messages,omitempty"`
+	// Leaderboard counts the cats summoned by each user in a repo, `/meow leaderboard`
+	// lists the top summoners. The counts are kept in memory.
+	Leaderboard bool `json:"leaderboard,omitempty"`
+	// DefaultsConfigMap is a namespace/name reference to the ConfigMap keeping
+	// the categories set with `/meow set-default`, it is created when needed.
+	// The categories are kept in memory, and lost on restart, when empty.
+	DefaultsConfigMap string `json:"defaults_config_map,omitempty"`
+	// DebugCommand lets the maintainers of a repo reply `/meow debug <argument>`
+	// to see the requests the `/meow <argument>` would make, with the key redacted.
+	DebugCommand bool `json:"debug_command,omitempty"`
+	// IncludeFact adds a random cat fact under the cats.
+	IncludeFact bool `json:"include_fact,omitempty"`
+	// FactsURL is an api answering with a random cat fact as a json object with
+	// a `fact`, e.g. https://catfact.ninja/fact. It is asked with the timeout and
+	// retries of the cat requests, the cats are posted without a fact when it
+	// fails. Defaults to the facts bundled with the bot.
+	FactsURL string `json:"facts_url,omitempty"`
+	// SafeMode only asks thecatapi.com for still images or gifs from a vetted set
+	// of categories, requests for any other category are turned down.
+	SafeMode bool `json:"safe_mode,omitempty"`
+	// OfTheDay posts a cat to an issue on a schedule.
+	OfTheDay CatOfTheDay `json:"of_the_day,omitempty"`
+	// Repos overrides the settings above for some orgs or repos.
+	Repos []CatRepo `json:"repos,omitempty"`
+}
+
+// CatOfTheDay is a cat posted to an issue on a schedule, the settings of the
+// repo of the issue apply.
+type CatOfTheDay struct {
+	// Schedule is a cron schedule in UTC, e.g. '0 9 * * 1-5' for 9am on weekdays,
+	// or in the location of a TZ= prefix.
+	// The cat of the day is off when empty.
+	Schedule string `json:"schedule,omitempty"`
+	// Repo is the org/repo of the issue
+	Repo string `json:"repo,omitempty"`
+	// Number is the number of the issue
+	Number int `json:"number,omitempty"`
+	// Category of the cat, defaults to a pick from DefaultCategories
+	Category string `json:"category,omitempty"`
+}
+
+// CatMessages are the replies of the cat plugin when no cat is posted, the
+// English defaults are used for the ones left empty.
+type CatMessages struct {
+	// BadCategory is the reply for a category that doesn't exist
+	BadCategory string `json:"bad_category,omitempty"`
+	// Down is the reply when thecatapi.com can't be reached
+	Down string `json:"down,omitempty"`
+	// NotFound is the reply when thecatapi.com had no cat to offer
+	NotFound string `json:"not_found,omitempty"`
+	// Busy is the reply when too many cats are already being looked for
+	Busy string `json:"busy,omitempty"`
+}
+
+// WeightedCategory is a category with the odds of it being picked by a bare /meow
+type WeightedCategory struct {
+	// Name is the category or breed
+	Name string `json:"name"`
+	// Weight is relative to the weights of the other categories.
+	// Defaults to 1.
+	Weight int `json:"weight,omitempty"`
+}
+
+// CatReplies overrides how the cats are posted on pull requests or on issues.
+type CatReplies struct {
+	// Collapsible overrides Cat.Collapsible when set.
+	Collapsible *bool `json:"collapsible,omitempty"`
+	// IncludeFact overrides Cat.IncludeFact when set.
+	IncludeFact *bool `json:"include_fact,omitempty"`
+	// Template is a Go template the cats are posted with, `{{.Cats}}` is the
+	// markdown of the cats and `{{.Author}}` the login of who asked for them.
+	// Defaults to the cats alone.
+	Template string             `json:"template,omitempty"`
+	Tmpl     *template.Template `json:"-"`
+}
+
+// CatRepo overrides the cat plugin configuration for some orgs or repos.
+type CatRepo struct {
+	// Repos is either of the form org/repos or just org.
+	Repos []string `json:"repos,omitempty"`
+	// Disabled turns the plugin off for these repos even when it is enabled for their org.
+	Disabled bool `json:"disabled,omitempty"`
+	// RequireMember overrides Cat.RequireMember when set.
+	RequireMember *bool `json:"require_member,omitempty"`
+	// AllowedCategories overrides Cat.AllowedCategories when set.
+	AllowedCategories []string `json:"allowed_categories,omitempty"`
+	// Messages overrides Cat.Messages when set.
+	Messages *CatMessages `json:"messages,omitempty"`
+}
+
+// CatFor finds the cat plugin configuration for a repo, the settings for the
+// repo itself take precedence over those for the owning organization.
+// The returned boolean is false when the plugin is disabled for the repo.
+func (c *Configuration) CatFor(org, repo string) (Cat, bool) {
+	cat := c.Cat
+	cat.Repos = nil
+	var match *CatRepo
+	full := fmt.Sprintf("%s/%s", org, repo)
+	for i := range c.Cat.Repos {
+		repos := sets.NewString(c.Cat.Repos[i].Repos...)
+		if repos.Has(full) {
+			match = &c.Cat.Repos[i]
+			break
+		}
+		if match == nil && repos.Has(org) {
+			match = &c.Cat.Repos[i]
+		}
+	}
+	if match == nil {
+		return cat, true
+	}
+	if match.RequireMember != nil {
+		cat.RequireMember = *match.RequireMember
+	}
+	if match.AllowedCategories != nil {
+		cat.AllowedCategories = match.AllowedCategories
+	}
+	if match.Messages != nil {
+		cat.Messages = *match.Messages
+	}
+	return cat, !match.Disabled
+}
+
+// RepliesFor returns the configuration with the overrides of Cat.PullRequests
+// or Cat.Issues, the replies are the same on both when there are none.
+func (c Cat) RepliesFor(pr bool) Cat {
+	replies := c.Issues
+	if pr {
+		replies = c.PullRequests
+	}
+	if replies == nil {
+		return c
+	}
+	if replies.Collapsible != nil {
+		c.Collapsible = *replies.Collapsible
+	}
+	if replies.IncludeFact != nil {
+		c.IncludeFact = *replies.IncludeFact
+	}
+	if replies.Tmpl != nil {
+		c.ReplyTmpl = replies.Tmpl
+	}
+	return c
+}
+
+// CategoryAllowed returns true if the category can be asked for
+func (c Cat) CategoryAllowed(category string) bool {
+	if category == "" || len(c.AllowedCategories) == 0 {
+		return true
+	}
+	for _, allowed := range c.AllowedCategories {
+		if strings.EqualFold(allowed, category) {
+			return true
+		}
+	}
+	return false
+}
+
+// CategorySynonym returns the category the term stands for in
+// CategorySynonyms, whatever the case and spacing of the term
+func (c Cat) CategorySynonym(term string) (string, bool) {
+	term = normalizeTerm(term)
+	for synonym, category := range c.CategorySynonyms {
+		if normalizeTerm(synonym) == term {
+			return category, true
+		}
+	}
+	return "", false
+}
+
+// normalizeTerm lowercases the term and collapses its whitespace
+func normalizeTerm(term string) string {
+	return strings.ToLower(strings.Join(strings.Fields(term), " "))
+}
+
+// Attempts returns the number of times the cat plugin tries to fetch an image
+func (c Cat) Attempts() int {
+	if c.Retries == nil {
+		return 3
+	}
+	if *c.Retries < 1 {
+		return 1
+	}
+	return *c.Retries
+}
+
+// RetriesStatus returns true if a cat provider answering with the status code
+// is asked again
+func (c Cat) RetriesStatus(code int) bool {
+	if len(c.RetryableStatusCodes) == 0 {
+		return code == http.StatusTooManyRequests || code >= 500
+	}
+	for _, retryable := range c.RetryableStatusCodes {
+		if retryable == code {
+			return true
+		}
+	}
+	return false
+}
+
+// BreakerFailureThreshold returns the number of consecutive failures opening
+// the circuit breaker of the cat plugin, 0 when it is disabled
+func (c Cat) BreakerFailureThreshold() int {
+	if c.BreakerThreshold == nil {
+		return 5
+	}
+	if *c.BreakerThreshold < 0 {
+		return 0
+	}
+	return *c.BreakerThreshold
+}
+
+// BigImageSizeLimit returns the largest image size in bytes posted when the
+// size limit is overridden
+func (c Cat) BigImageSizeLimit() int {
+	if c.BigImageSizeBytes <= 0 {
+		return 100000000
+	}
+	return c.BigImageSizeBytes
+}
+
+// CommentLengthLimit returns the longest comment in bytes posted by the cat plugin
+func (c Cat) CommentLengthLimit() int {
+	if c.MaxCommentLength <= 0 {
+		return 65536
+	}
+	return c.MaxCommentLength
+}
+
+// RequestRate returns the requests per second and burst of the rate limit of
+// the cat plugin, the rate is 0 when it is disabled
+func (c Cat) RequestRate() (float64, int) {
+	limit := 10.0
+	if c.RateLimit != nil {
+		limit = *c.RateLimit
+	}
+	if limit <= 0 {
+		return 0, 0
+	}
+	burst := c.RateBurst
+	if burst <= 0 {
+		burst = int(2 * limit)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return limit, burst
+}
+
+// Backoff returns the delays between the attempts of the cat plugin, starting
+// from RetryBackoff and doubled for every subsequent attempt.
+func (c Cat) Backoff() Backoff {
+	return Backoff{Base: c.RetryBackoffDuration, Factor: 2}
+}
+
+// StrictGrumpy returns true when only an argument made of a grumpy keyword
+// gets the grumpy cat
+func (c Cat) StrictGrumpy() bool {
+	return c.GrumpyStrict == nil || *c.GrumpyStrict
+}
+
+// HTTPSRequired returns true when only https images are posted
+func (c Cat) HTTPSRequired() bool {
+	return c.RequireHTTPS == nil || *c.RequireHTTPS
+}
+
+// AcknowledgeReaction returns the reaction accepting a cat request, empty
+// when none is added
+func (c Cat) AcknowledgeReaction() string {
+	if c.AckReaction == nil {
+		return "eyes"
+	}
+	return *c.AckReaction
+}
+
+// Jitter returns the fraction by which the timers of the cat plugin are spread,
+// between 0 and 1
+func (c Cat) Jitter() float64 {
+	if c.JitterFactor == nil {
+		return 0.1
+	}
+	if *c.JitterFactor < 0 {
+		return 0
+	}
+	if *c.JitterFactor > 1 {
+		return 1
+	}
+	return *c.JitterFactor
 }
 
 // Label contains the configuration for the label plugin.
@@ -606,6 +1160,44 @@ The list of patch release managers for each release can be found [here](https://
 			c.RequireMatchingLabel[i].GracePeriod = "5s"
 		}
 	}
+	if c.Cat.RetryBackoff == "" {
+		c.Cat.RetryBackoff = "500ms"
+	}
+	if c.Cat.MaxRetryAfter == "" {
+		c.Cat.MaxRetryAfter = "10s"
+	}
+	for i := range c.Cat.DefaultCategories {
+		if c.Cat.DefaultCategories[i].Weight == 0 {
+			c.Cat.DefaultCategories[i].Weight = 1
+		}
+	}
+	if c.Cat.MaxTotalTime == "" {
+		c.Cat.MaxTotalTime = "0s"
+	}
+	if c.Cat.RequestTimeout == "" {
+		c.Cat.RequestTimeout = "10s"
+	}
+	if c.Cat.KeyReloadInterval == "" {
+		c.Cat.KeyReloadInterval = "1m"
+	}
+	if c.Cat.HealthCheckInterval == "" {
+		c.Cat.HealthCheckInterval = "5m"
+	}
+	if c.Cat.Cooldown == "" {
+		c.Cat.Cooldown = "5s"
+	}
+	if c.Cat.BreakerCooldown == "" {
+		c.Cat.BreakerCooldown = "1m"
+	}
+	if c.Cat.CacheTTL == "" {
+		c.Cat.CacheTTL = "0s"
+	}
+	if c.Cat.RateLimitWait == "" {
+		c.Cat.RateLimitWait = "1s"
+	}
+	if c.Cat.FetchQueueWait == "" {
+		c.Cat.FetchQueueWait = "1s"
+	}
 }
 
 // ValidatePluginsArePresent takes a map with plugin names as keys and errors or logs for each configured plugin that can't be found.
@@ -656,6 +1248,146 @@ func validateSizes(size Size) error {
 	return nil
 }
 
+func validateCat(cat Cat) error {
+	switch cat.ImageSizeStrategy {
+	case "", "head", "range":
+	default:
+		return fmt.Errorf("invalid cat plugin configuration - unknown image size strategy %q, expected head or range", cat.ImageSizeStrategy)
+	}
+	switch cat.APIVersion {
+	case "", "v0", "v1":
+	default:
+		return fmt.Errorf("invalid cat plugin configuration - unknown api version %q, expected v0 or v1", cat.APIVersion)
+	}
+	switch cat.ImageFormat {
+	case "", "markdown", "html":
+	default:
+		return fmt.Errorf("invalid cat plugin configuration - unknown image format %q, expected markdown or html", cat.ImageFormat)
+	}
+	for provider, format := range cat.ProviderImageFormats {
+		switch format {
+		case "markdown", "html":
+		default:
+			return fmt.Errorf("invalid cat plugin configuration - unknown image format %q of provider %q, expected markdown or html", format, provider)
+		}
+	}
+	for _, code := range cat.RetryableStatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid cat plugin configuration - retryable status code %d is not an http status", code)
+		}
+	}
+	for _, category := range cat.DefaultCategories {
+		if strings.TrimSpace(category.Name) == "" {
+			return errors.New("invalid cat plugin configuration - default categories need a name")
+		}
+		if category.Weight < 0 {
+			return fmt.Errorf("invalid cat plugin configuration - default category %q has a negative weight %d", category.Name, category.Weight)
+		}
+	}
+	synonyms := sets.NewString()
+	for synonym, category := range cat.CategorySynonyms {
+		term := normalizeTerm(synonym)
+		if term == "" || strings.TrimSpace(category) == "" {
+			return fmt.Errorf("invalid cat plugin configuration - category synonym %q of %q can't be empty", synonym, category)
+		}
+		if synonyms.Has(term) {
+			return fmt.Errorf("invalid cat plugin configuration - category synonym %q is listed more than once", synonym)
+		}
+		synonyms.Insert(term)
+	}
+	providers := sets.NewString(cat.Providers...)
+	for provider, weight := range cat.ProviderWeights {
+		if weight < 0 {
+			return fmt.Errorf("invalid cat plugin configuration - provider %q has a negative weight %d", provider, weight)
+		}
+		if !providers.Has(provider) {
+			return fmt.Errorf("invalid cat plugin configuration - provider weight for %q which is not one of the providers", provider)
+		}
+	}
+	for provider, path := range cat.ImagePaths {
+		for _, segment := range strings.Split(path, ".") {
+			if segment == "" {
+				return fmt.Errorf("invalid cat plugin configuration - image path %q of provider %q has an empty segment", path, provider)
+			}
+		}
+	}
+	if day := cat.OfTheDay; day.Schedule != "" {
+		if _, err := parseSchedule(day.Schedule); err != nil {
+			return fmt.Errorf("invalid cat plugin configuration - cat of the day: %v", err)
+		}
+		if parts := strings.Split(day.Repo, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid cat plugin configuration - cat of the day repo %q is not of the form org/repo", day.Repo)
+		}
+		if day.Number < 1 {
+			return fmt.Errorf("invalid cat plugin configuration - cat of the day needs the number of an issue, got %d", day.Number)
+		}
+	}
+	for _, host := range cat.AllowedImageHosts {
+		if host == "" || strings.ContainsAny(host, "/:") {
+			return fmt.Errorf("invalid cat plugin configuration - allowed image host %q is not a host name", host)
+		}
+	}
+	if cat.APIURL != "" {
+		u, err := url.Parse(cat.APIURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid cat plugin configuration - api url %q is not an http or https url", cat.APIURL)
+		}
+	}
+	if ref := cat.DefaultsConfigMap; ref != "" {
+		if parts := strings.Split(ref, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid cat plugin configuration - defaults configmap %q is not of the form namespace/name", ref)
+		}
+	}
+	if cat.ProxyURL != "" {
+		u, err := url.Parse(cat.ProxyURL)
+		if err != nil {
+			// the parse error would show the password of the proxy
+			return errors.New("invalid cat plugin configuration - proxy url is not a valid url")
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("invalid cat plugin configuration - proxy url %q is not an http, https or socks5 url", u.Redacted())
+		}
+	}
+	if cat.FactsURL != "" {
+		u, err := url.Parse(cat.FactsURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid cat plugin configuration - facts url %q is not an http or https url", cat.FactsURL)
+		}
+	}
+	return nil
+}
+
+// catKeyPathWarning returns a warning when the cat api key file can't be
+// read, the api still works without a key at a lower rate so it isn't an error.
+func catKeyPathWarning(cat Cat) string {
+	if cat.KeyPath == "" || cat.KeySecret != "" {
+		return ""
+	}
+	if _, err := os.ReadFile(cat.KeyPath); err != nil {
+		return fmt.Sprintf("cat plugin key_path %q can't be read, thecatapi.com will be used without a key: %v", cat.KeyPath, err)
+	}
+	return ""
+}
+
+// warnCatKeyPath logs the catKeyPathWarning, once for as long as the same
+// path stays unreadable across config reloads.
+func warnCatKeyPath(cat Cat) {
+	warning := catKeyPathWarning(cat)
+	warnLock.Lock()
+	defer warnLock.Unlock()
+	if warning == "" {
+		warnedCatKeyPath = ""
+		return
+	}
+	if warnedCatKeyPath == cat.KeyPath {
+		return
+	}
+	warnedCatKeyPath = cat.KeyPath
+	logrus.WithField("plugin", "cat").Warn(warning)
+}
+
 func findDuplicatedPluginConfig(repoConfig, orgConfig []string) []string {
 	var dupes []string
 	for _, repoPlugin := range repoConfig {
@@ -747,6 +1479,14 @@ func compileRegexpsAndDurations(pc *Configuration) error {
 	}
 	pc.CherryPickUnapproved.BranchRe = branchRe
 
+	if pc.ResponseTemplate != "" {
+		tmpl, err := template.New("response").Parse(pc.ResponseTemplate)
+		if err != nil {
+			return fmt.Errorf("invalid response_template: %v", err)
+		}
+		pc.ResponseTmpl = tmpl
+	}
+
 	rs := pc.RequireMatchingLabel
 	for i := range rs {
 		re, err := regexp.Compile(rs[i].Regexp)
@@ -762,6 +1502,99 @@ func compileRegexpsAndDurations(pc *Configuration) error {
 		}
 		rs[i].GracePeriodDuration = dur
 	}
+
+	if len(pc.Cat.GrumpyKeywords) > 0 {
+		keywords := make([]string, 0, len(pc.Cat.GrumpyKeywords))
+		for _, k := range pc.Cat.GrumpyKeywords {
+			keywords = append(keywords, regexp.QuoteMeta(k))
+		}
+		pattern := `(?mi)^(` + strings.Join(keywords, "|") + `)\s*$`
+		if !pc.Cat.StrictGrumpy() {
+			pattern = `(?i)(?:^|[^\pL\pN])(` + strings.Join(keywords, "|") + `)(?:[^\pL\pN]|$)`
+		}
+		grumpyRe, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("failed to compile cat grumpy keywords: %q, error: %v", pc.Cat.GrumpyKeywords, err)
+		}
+		pc.Cat.GrumpyKeywordsRe = grumpyRe
+	}
+
+	for name, replies := range map[string]*CatReplies{"pull_requests": pc.Cat.PullRequests, "issues": pc.Cat.Issues} {
+		if replies == nil || replies.Template == "" {
+			continue
+		}
+		tmpl, err := template.New(name).Parse(replies.Template)
+		if err != nil {
+			return fmt.Errorf("invalid cat %s template: %v", name, err)
+		}
+		replies.Tmpl = tmpl
+	}
+
+	backoff, err := time.ParseDuration(pc.Cat.RetryBackoff)
+	if err != nil {
+		return fmt.Errorf("failed to compile cat retry backoff duration: %q, error: %v", pc.Cat.RetryBackoff, err)
+	}
+	pc.Cat.RetryBackoffDuration = backoff
+
+	maxRetryAfter, err := time.ParseDuration(pc.Cat.MaxRetryAfter)
+	if err != nil {
+		return fmt.Errorf("failed to compile cat max retry after duration: %q, error: %v", pc.Cat.MaxRetryAfter, err)
+	}
+	pc.Cat.MaxRetryAfterDuration = maxRetryAfter
+
+	maxTotalTime, err := time.ParseDuration(pc.Cat.MaxTotalTime)
+	if err != nil {
+		return fmt.Errorf("failed to compile cat max total time duration: %q, error: %v", pc.Cat.MaxTotalTime, err)
+	}
+	pc.Cat.MaxTotalTimeDuration = maxTotalTime
+
+	timeout, err := time.ParseDuration(pc.Cat.RequestTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to compile cat request timeout duration: %q, error: %v", pc.Cat.RequestTimeout, err)
+	}
+	pc.Cat.RequestTimeoutDuration = timeout
+
+	reload, err := time.ParseDuration(pc.Cat.KeyReloadInterval)
+	if err != nil {
+		return fmt.Errorf("failed to compile cat key reload interval duration: %q, error: %v", pc.Cat.KeyReloadInterval, err)
+	}
+	pc.Cat.KeyReloadIntervalDuration = reload
+
+	healthCheck, err := time.ParseDuration(pc.Cat.HealthCheckInterval)
+	if err != nil {
+		return fmt.Errorf("failed to compile cat health check interval duration: %q, error: %v", pc.Cat.HealthCheckInterval, err)
+	}
+	pc.Cat.HealthCheckIntervalDuration = healthCheck
+
+	cooldown, err := time.ParseDuration(pc.Cat.Cooldown)
+	if err != nil {
+		return fmt.Errorf("failed to compile cat cooldown duration: %q, error: %v", pc.Cat.Cooldown, err)
+	}
+	pc.Cat.CooldownDuration = cooldown
+
+	breakerCooldown, err := time.ParseDuration(pc.Cat.BreakerCooldown)
+	if err != nil {
+		return fmt.Errorf("failed to compile cat breaker cooldown duration: %q, error: %v", pc.Cat.BreakerCooldown, err)
+	}
+	pc.Cat.BreakerCooldownDuration = breakerCooldown
+
+	cacheTTL, err := time.ParseDuration(pc.Cat.CacheTTL)
+	if err != nil {
+		return fmt.Errorf("failed to compile cat cache ttl duration: %q, error: %v", pc.Cat.CacheTTL, err)
+	}
+	pc.Cat.CacheTTLDuration = cacheTTL
+
+	rateLimitWait, err := time.ParseDuration(pc.Cat.RateLimitWait)
+	if err != nil {
+		return fmt.Errorf("failed to compile cat rate limit wait duration: %q, error: %v", pc.Cat.RateLimitWait, err)
+	}
+	pc.Cat.RateLimitWaitDuration = rateLimitWait
+
+	fetchQueueWait, err := time.ParseDuration(pc.Cat.FetchQueueWait)
+	if err != nil {
+		return fmt.Errorf("failed to compile cat fetch queue wait duration: %q, error: %v", pc.Cat.FetchQueueWait, err)
+	}
+	pc.Cat.FetchQueueWaitDuration = fetchQueueWait
 	return nil
 }
 
@@ -793,6 +1626,10 @@ func (c *Configuration) Validate() error {
 	if err := validateRequireMatchingLabel(c.RequireMatchingLabel); err != nil {
 		return err
 	}
+	if err := validateCat(c.Cat); err != nil {
+		return err
+	}
+	warnCatKeyPath(c.Cat)
 
 	return nil
 }
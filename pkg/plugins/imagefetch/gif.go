@@ -0,0 +1,112 @@
+package imagefetch
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	gifExtension  = 0x21
+	gifImage      = 0x2C
+	gifTrailer    = 0x3B
+	gifColorTable = 0x80
+)
+
+// CountGifFrames counts the frames of the gif read from r without decoding
+// them. It stops reading once there are more than limit frames, zero counts
+// all the frames, and fails with ErrInvalid when r isn't a gif.
+func CountGifFrames(r io.Reader, limit int) (int, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return 0, fmt.Errorf("%w: could not read the gif header: %v", ErrInvalid, err)
+	}
+	if sig := string(header[:6]); sig != "GIF87a" && sig != "GIF89a" {
+		return 0, fmt.Errorf("%w: not a gif", ErrInvalid)
+	}
+	if err := skipColorTable(br, header[10]); err != nil {
+		return 0, err
+	}
+	frames := 0
+	for {
+		block, err := br.ReadByte()
+		if err != nil {
+			return frames, err
+		}
+		switch block {
+		case gifExtension:
+			if _, err := br.ReadByte(); err != nil {
+				return frames, err
+			}
+		case gifImage:
+			descriptor := make([]byte, 9)
+			if _, err := io.ReadFull(br, descriptor); err != nil {
+				return frames, err
+			}
+			if err := skipColorTable(br, descriptor[8]); err != nil {
+				return frames, err
+			}
+			// the minimum code size of the lzw data
+			if _, err := br.ReadByte(); err != nil {
+				return frames, err
+			}
+			frames++
+			if limit > 0 && frames > limit {
+				return frames, nil
+			}
+		case gifTrailer:
+			return frames, nil
+		default:
+			return frames, fmt.Errorf("%w: unknown gif block 0x%02x", ErrInvalid, block)
+		}
+		if err := skipSubBlocks(br); err != nil {
+			return frames, err
+		}
+	}
+}
+
+// skipColorTable skips the color table described by the packed fields, if any
+func skipColorTable(r io.Reader, packed byte) error {
+	if packed&gifColorTable == 0 {
+		return nil
+	}
+	_, err := io.CopyN(io.Discard, r, 3<<((packed&0x07)+1))
+	return err
+}
+
+// skipSubBlocks skips the data sub-blocks up to the terminating empty block
+func skipSubBlocks(r *bufio.Reader) error {
+	for {
+		size, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(size)); err != nil {
+			return err
+		}
+	}
+}
+
+// GifFrames downloads the gif to count its frames, see CountGifFrames. At most
+// MaxSize bytes are read, a longer gif is counted as far as that.
+func (f Fetcher) GifFrames(ctx context.Context, image string, limit int) (int, error) {
+	req, err := f.NewRequest(ctx, http.MethodGet, image)
+	if err != nil {
+		return 0, fmt.Errorf("%w: could not create request for %s: %v", ErrInvalid, image, err)
+	}
+	resp, err := f.client().Do(req) // #nosec
+	if err != nil {
+		return 0, Transient(fmt.Errorf("could not download %s: %w", image, err))
+	}
+	defer resp.Body.Close()
+	if sc := resp.StatusCode; sc > 299 || sc < 200 {
+		return 0, &StatusError{URI: image, StatusCode: sc}
+	}
+	return CountGifFrames(io.LimitReader(resp.Body, int64(f.limit())), limit)
+}
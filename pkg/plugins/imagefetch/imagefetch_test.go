@@ -0,0 +1,652 @@
+package imagefetch
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/lighthouse/pkg/scmprovider"
+)
+
+func TestGet(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			io.WriteString(w, `[{"url":"http://example.com/a.jpg"}]`)
+		case "/limited":
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/huge":
+			w.Header().Set("Content-Length", "2000")
+			io.WriteString(w, strings.Repeat("x", 2000))
+		case "/huge-chunked":
+			w.(http.Flusher).Flush()
+			io.WriteString(w, strings.Repeat("x", 2000))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	f := Fetcher{}
+	body, err := f.Get(context.Background(), ts.URL+"/ok")
+	if err != nil || string(body) != `[{"url":"http://example.com/a.jpg"}]` {
+		t.Errorf("expected the body, got %q, %v", body, err)
+	}
+
+	_, err = f.Get(context.Background(), ts.URL+"/limited")
+	var rl *RateLimitedError
+	if !errors.As(err, &rl) || rl.RetryAfter != 3*time.Second {
+		t.Errorf("expected to be rate limited for 3s, got %v", err)
+	}
+	if !errors.Is(err, ErrTransient) {
+		t.Errorf("expected rate limiting to be transient, got %v", err)
+	}
+
+	_, err = f.Get(context.Background(), ts.URL+"/down")
+	var statusErr *StatusError
+	if !errors.Is(err, ErrTransient) || !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected a transient 503, got %v", err)
+	}
+
+	_, err = f.Get(context.Background(), ts.URL+"/missing")
+	if errors.Is(err, ErrTransient) || !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a 404 that is not transient, got %v", err)
+	}
+
+	for _, path := range []string{"/huge", "/huge-chunked"} {
+		if _, err = (Fetcher{MaxResponseSize: 1000}).Get(context.Background(), ts.URL+path); !errors.Is(err, ErrInvalid) || errors.Is(err, ErrTransient) {
+			t.Errorf("%s: expected a response over the limit to be invalid, got %v", path, err)
+		}
+	}
+	if body, err := f.Get(context.Background(), ts.URL+"/huge-chunked"); err != nil || len(body) != 2000 {
+		t.Errorf("expected the response within the default limit, got %d bytes, %v", len(body), err)
+	}
+
+	ts.Close()
+	if _, err = f.Get(context.Background(), ts.URL+"/ok"); !errors.Is(err, ErrTransient) {
+		t.Errorf("expected an unreachable provider to be transient, got %v", err)
+	}
+}
+
+func TestGetCompressed(t *testing.T) {
+	answer := `[{"url":"http://example.com/a.jpg"}]`
+	compress := func(w io.WriteCloser, body string) {
+		_, _ = io.WriteString(w, body)
+		_ = w.Close()
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accept := r.Header.Get("Accept-Encoding"); accept != "gzip, deflate" {
+			t.Errorf("expected compressed responses to be asked for, got %q", accept)
+		}
+		var buf bytes.Buffer
+		switch r.URL.Path {
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			compress(gzip.NewWriter(&buf), answer)
+		case "/zlib":
+			w.Header().Set("Content-Encoding", "deflate")
+			compress(zlib.NewWriter(&buf), answer)
+		case "/deflate":
+			w.Header().Set("Content-Encoding", "deflate")
+			fw, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+			compress(fw, answer)
+		case "/bomb":
+			w.Header().Set("Content-Encoding", "gzip")
+			compress(gzip.NewWriter(&buf), strings.Repeat("x", 2000))
+		case "/brotli":
+			w.Header().Set("Content-Encoding", "br")
+			buf.WriteString(answer)
+		case "/not-gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			buf.WriteString(answer)
+		}
+		_, _ = w.Write(buf.Bytes())
+	}))
+	defer ts.Close()
+
+	for _, path := range []string{"/gzip", "/zlib", "/deflate"} {
+		if body, err := (Fetcher{}).Get(context.Background(), ts.URL+path); err != nil || string(body) != answer {
+			t.Errorf("%s: expected the decoded body, got %q, %v", path, body, err)
+		}
+	}
+	if _, err := (Fetcher{MaxResponseSize: 1000}).Get(context.Background(), ts.URL+"/bomb"); !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("expected the decoded body to be held to the limit, got %v", err)
+	}
+	for _, path := range []string{"/brotli", "/not-gzip"} {
+		if _, err := (Fetcher{}).Get(context.Background(), ts.URL+path); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected a body that can't be decoded to be invalid, got %v", path, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cat.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Header().Set("Content-Length", "1000")
+		case "/cat.gif":
+			w.Header().Set("Content-Type", "image/gif")
+			w.Header().Set("Content-Length", "1000")
+		case "/big.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Header().Set("Content-Length", "5000")
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		name      string
+		image     string
+		mimeTypes []string
+		expected  error
+	}{
+		{name: "image", image: "/cat.jpg"},
+		{name: "too big", image: "/big.jpg", expected: ErrTooBig},
+		{name: "not an image", image: "/page.html", expected: ErrInvalid},
+		{name: "missing", image: "/missing.jpg", expected: ErrTransient},
+		{name: "filtered", image: "/cat.jpg", mimeTypes: []string{"image/gif"}, expected: ErrInvalid},
+		{name: "accepted by the filter", image: "/cat.gif", mimeTypes: []string{"image/gif"}},
+	}
+	for _, tc := range cases {
+		f := Fetcher{MaxSize: 2000, MimeTypes: tc.mimeTypes}
+		err := f.Validate(context.Background(), ts.URL+tc.image)
+		if tc.expected == nil && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		} else if tc.expected != nil && !errors.Is(err, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, err)
+		}
+	}
+	if err := (Fetcher{}).Validate(context.Background(), ""); !errors.Is(err, ErrNoImages) {
+		t.Errorf("expected no images for an empty url, got %v", err)
+	}
+
+	var tooBig *TooBigError
+	if err := (Fetcher{MaxSize: 2000}).Validate(context.Background(), ts.URL+"/big.jpg"); !errors.As(err, &tooBig) || tooBig.Size != 5000 || tooBig.Limit != 2000 {
+		t.Errorf("expected the measured size and the limit, got %v", err)
+	}
+}
+
+func TestValidateStubbedDetails(t *testing.T) {
+	for size, expected := range map[int]error{1000: nil, 5000: ErrTooBig} {
+		size := size
+		f := Fetcher{MaxSize: 2000, Details: func(ctx context.Context, image string, opts scmprovider.ImageOptions) (scmprovider.ImageDetails, error) {
+			if opts.Limit != 2000 {
+				t.Errorf("expected the size limit in the options, got %d", opts.Limit)
+			}
+			return scmprovider.ImageDetails{Size: size, ContentType: "image/png"}, nil
+		}}
+		if err := f.Validate(context.Background(), "https://cats.invalid/cat.png"); !errors.Is(err, expected) {
+			t.Errorf("size %d: expected %v, got %v", size, expected, err)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cat.jpg" {
+			http.Redirect(w, r, "/cdn/cat.jpg", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Content-Length", "1000")
+	}))
+	defer ts.Close()
+
+	resolved, err := Fetcher{}.Resolve(context.Background(), ts.URL+"/cat.jpg")
+	if err != nil || resolved != ts.URL+"/cdn/cat.jpg" {
+		t.Errorf("expected the image to resolve to %s/cdn/cat.jpg, got %s (%v)", ts.URL, resolved, err)
+	}
+	if _, err := (Fetcher{MaxSize: 500}).Resolve(context.Background(), ts.URL+"/cat.jpg"); !errors.Is(err, ErrTooBig) {
+		t.Errorf("expected the image at the end of the redirects to be too big, got %v", err)
+	}
+	// details that don't know where the image is keep the url asked for
+	stubbed := Fetcher{Details: func(ctx context.Context, image string, opts scmprovider.ImageOptions) (scmprovider.ImageDetails, error) {
+		return scmprovider.ImageDetails{Size: 1000, ContentType: "image/png"}, nil
+	}}
+	if resolved, err := stubbed.Resolve(context.Background(), "https://cats.invalid/cat.png"); err != nil || resolved != "https://cats.invalid/cat.png" {
+		t.Errorf("expected the url asked for, got %s (%v)", resolved, err)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cat.jpg" {
+			http.Redirect(w, r, "/cdn/cat.jpg", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Content-Length", "1000")
+	}))
+	defer ts.Close()
+
+	details, err := Fetcher{}.Inspect(context.Background(), ts.URL+"/cat.jpg")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if details.URL != ts.URL+"/cdn/cat.jpg" || details.Size != 1000 || details.ContentType != "image/jpeg" {
+		t.Errorf("expected the 1000 byte jpeg at %s/cdn/cat.jpg, got %+v", ts.URL, details)
+	}
+	if _, err := (Fetcher{}).Inspect(context.Background(), ""); !errors.Is(err, ErrNoImages) {
+		t.Errorf("expected no images for an empty url, got %v", err)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cat.jpg":
+			w.Write(bytes.Repeat([]byte("c"), 1000))
+		case "/big.jpg":
+			w.Header().Set("Content-Length", "5000")
+			w.Write(bytes.Repeat([]byte("c"), 5000))
+		case "/chunked.jpg":
+			// no Content-Length, the size is only known once read
+			w.(http.Flusher).Flush()
+			w.Write(bytes.Repeat([]byte("c"), 5000))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		name     string
+		image    string
+		expected error
+	}{
+		{name: "image", image: "/cat.jpg"},
+		{name: "too big", image: "/big.jpg", expected: ErrTooBig},
+		{name: "too big without length", image: "/chunked.jpg", expected: ErrTooBig},
+	}
+	for _, tc := range cases {
+		body, err := Fetcher{MaxSize: 2000}.Download(context.Background(), ts.URL+tc.image)
+		if tc.expected == nil {
+			if err != nil || len(body) != 1000 {
+				t.Errorf("%s: expected 1000 bytes, got %d: %v", tc.name, len(body), err)
+			}
+		} else if !errors.Is(err, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, err)
+		}
+	}
+	var statusErr *StatusError
+	if _, err := (Fetcher{}).Download(context.Background(), ts.URL+"/missing.jpg"); !errors.As(err, &statusErr) {
+		t.Errorf("expected a status error for a missing image, got %v", err)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	md, err := Markdown("dog image", "http://example.com/dog.jpg")
+	if err != nil || md != "![dog image](http://example.com/dog.jpg)" {
+		t.Errorf("unexpected markdown %q, %v", md, err)
+	}
+	if _, err := Markdown("dog image", ""); err == nil {
+		t.Error("expected an error for an empty url")
+	}
+}
+
+func TestHTML(t *testing.T) {
+	tag, err := HTML("dog image", "http://example.com/dog.jpg?a=1&b=2")
+	if err != nil || tag != `<img src="http://example.com/dog.jpg?a=1&amp;b=2" alt="dog image">` {
+		t.Errorf("unexpected html %q, %v", tag, err)
+	}
+	if _, err := HTML("dog image", ""); err == nil {
+		t.Error("expected an error for an empty url")
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	client, err := NewClient(time.Second, "")
+	if err != nil || client.Timeout != time.Second || client.Transport != nil {
+		t.Errorf("expected a plain client with the timeout, got %+v, %v", client, err)
+	}
+	client, err = NewClient(time.Second, "http://proxy.example.com:3128")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://api.example.com", nil)
+	proxy, err := client.Transport.(*http.Transport).Proxy(req)
+	if err != nil || proxy.String() != "http://proxy.example.com:3128" {
+		t.Errorf("expected requests to go through the proxy, got %v, %v", proxy, err)
+	}
+	if _, err := NewClient(time.Second, "://bad"); err == nil {
+		t.Error("expected an error for an invalid proxy")
+	}
+	if _, err := NewClient(time.Second, "ftp://proxy.example.com"); err == nil {
+		t.Error("expected an error for an unsupported proxy scheme")
+	}
+}
+
+// image serves a 2000 byte png
+func image(t *testing.T) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Length", "2000")
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestImageTooBigThroughHTTPProxy(t *testing.T) {
+	img := image(t)
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("user:secret")) {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		atomic.AddInt32(&proxied, 1)
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+	}))
+	defer proxy.Close()
+
+	client, err := NewClient(time.Second, "http://user:secret@"+proxy.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	details, err := scmprovider.GetImageDetailsWithOptions(context.Background(), img.URL+"/cat.png", scmprovider.ImageOptions{Client: client})
+	if err != nil || details.TooBig(0) {
+		t.Errorf("expected the image to fit, got %d bytes, %v", details.Size, err)
+	}
+	if atomic.LoadInt32(&proxied) != 1 {
+		t.Errorf("expected the size check to go through the proxy, got %d requests", proxied)
+	}
+
+	client, _ = NewClient(time.Second, "http://user:wrong@"+proxy.Listener.Addr().String())
+	if _, err := scmprovider.GetImageDetailsWithOptions(context.Background(), img.URL+"/cat.png", scmprovider.ImageOptions{Client: client}); err == nil {
+		t.Error("expected the size check to fail with the wrong proxy credentials")
+	}
+}
+
+// socks5 is a minimal SOCKS5 proxy requiring the user and password
+func socks5(t *testing.T, user, password string, connections *int32) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				target, ok := socks5Handshake(r, conn, user, password)
+				if !ok {
+					return
+				}
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer upstream.Close()
+				atomic.AddInt32(connections, 1)
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				go io.Copy(upstream, r)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func socks5Handshake(r *bufio.Reader, w io.Writer, user, password string) (string, bool) {
+	read := func(n int) []byte {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil
+		}
+		return b
+	}
+	greeting := read(2)
+	if greeting == nil || greeting[0] != 5 || read(int(greeting[1])) == nil {
+		return "", false
+	}
+	// username/password authentication
+	w.Write([]byte{5, 2})
+	version := read(2)
+	if version == nil {
+		return "", false
+	}
+	u := read(int(version[1]))
+	pl := read(1)
+	if u == nil || pl == nil {
+		return "", false
+	}
+	p := read(int(pl[0]))
+	if string(u) != user || string(p) != password {
+		w.Write([]byte{1, 1})
+		return "", false
+	}
+	w.Write([]byte{1, 0})
+	req := read(4)
+	if req == nil || req[1] != 1 {
+		return "", false
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		host = net.IP(read(4)).String()
+	case 3:
+		l := read(1)
+		if l == nil {
+			return "", false
+		}
+		host = string(read(int(l[0])))
+	default:
+		return "", false
+	}
+	port := read(2)
+	if port == nil {
+		return "", false
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), true
+}
+
+func TestValidateThroughSOCKS5Proxy(t *testing.T) {
+	img := image(t)
+	var connections int32
+	proxy := socks5(t, "user", "secret", &connections)
+
+	client, err := NewClient(time.Second, "socks5://user:secret@"+proxy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f := Fetcher{Client: client}
+	if err := f.Validate(context.Background(), img.URL+"/cat.png"); err != nil {
+		t.Errorf("expected the image to be valid, got %v", err)
+	}
+	if atomic.LoadInt32(&connections) == 0 {
+		t.Error("expected the size check to go through the proxy")
+	}
+
+	client, _ = NewClient(time.Second, "socks5://user:wrong@"+proxy)
+	f = Fetcher{Client: client}
+	if err := f.Validate(context.Background(), img.URL+"/cat.png"); !errors.Is(err, ErrTransient) {
+		t.Errorf("expected the size check to fail with the wrong proxy credentials, got %v", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := ParseRetryAfter("3"); got != 3*time.Second {
+		t.Errorf("expected 3s, got %v", got)
+	}
+	if got := ParseRetryAfter(""); got != 0 {
+		t.Errorf("expected no wait for a missing header, got %v", got)
+	}
+	if got := ParseRetryAfter("soon"); got != 0 {
+		t.Errorf("expected no wait for an invalid header, got %v", got)
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := ParseRetryAfter(date); got <= 0 || got > time.Minute {
+		t.Errorf("expected a wait of up to a minute for %s, got %v", date, got)
+	}
+}
+
+func TestValidateSizeStrategy(t *testing.T) {
+	var gets int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		if r.Method == http.MethodGet {
+			gets++
+		}
+		switch r.URL.Path {
+		case "/length.jpg":
+			w.Header().Set("Content-Length", "5000")
+		case "/ranged.jpg":
+			// no Content-Length on HEAD, like some CDNs
+			if r.Method == http.MethodGet && r.Header.Get("Range") == "bytes=0-0" {
+				w.Header().Set("Content-Range", "bytes 0-0/5000")
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte{0})
+			}
+		case "/ignores-range.jpg":
+			if r.Method == http.MethodGet {
+				// flushing sends the image chunked, without a Content-Length
+				for i := 0; i < 5; i++ {
+					w.Write(make([]byte, 1000))
+					w.(http.Flusher).Flush()
+				}
+			}
+		case "/rejects-range.jpg":
+			if r.Method == http.MethodGet {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			w.Header().Set("Content-Length", "5000")
+		}
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		name     string
+		image    string
+		strategy scmprovider.ImageSizeStrategy
+		gets     int
+	}{
+		{name: "head with length", image: "/length.jpg", strategy: scmprovider.ImageSizeHead},
+		{name: "head falls back to range", image: "/ranged.jpg", strategy: scmprovider.ImageSizeHead, gets: 1},
+		{name: "head falls back to counting", image: "/ignores-range.jpg", gets: 1},
+		{name: "range", image: "/ranged.jpg", strategy: scmprovider.ImageSizeRange, gets: 1},
+		{name: "range ignored", image: "/ignores-range.jpg", strategy: scmprovider.ImageSizeRange, gets: 1},
+		{name: "range falls back to head", image: "/rejects-range.jpg", strategy: scmprovider.ImageSizeRange, gets: 1},
+	}
+	for _, tc := range cases {
+		gets = 0
+		f := Fetcher{MaxSize: 2000, SizeStrategy: tc.strategy}
+		if err := f.Validate(context.Background(), ts.URL+tc.image); !errors.Is(err, ErrTooBig) {
+			t.Errorf("%s: expected the 5000 byte image to be too big, got %v", tc.name, err)
+		}
+		if gets != tc.gets {
+			t.Errorf("%s: expected %d GET requests, got %d", tc.name, tc.gets, gets)
+		}
+		f.MaxSize = 10000
+		if err := f.Validate(context.Background(), ts.URL+tc.image); err != nil {
+			t.Errorf("%s: expected the image to be under a bigger limit, got %v", tc.name, err)
+		}
+	}
+}
+
+// animatedGif crafts a 1x1 gif with a global color table and the number of
+// frames, each one after a graphic control extension
+func animatedGif(frames int) []byte {
+	data := []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00" + "\x00\x00\x00\xff\xff\xff")
+	for i := 0; i < frames; i++ {
+		data = append(data, "\x21\xf9\x04\x00\x0a\x00\x00\x00"...)
+		data = append(data, "\x2c\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02\x44\x01\x00"...)
+	}
+	return append(data, gifTrailer)
+}
+
+func TestCountGifFrames(t *testing.T) {
+	three := animatedGif(3)
+	cases := []struct {
+		name     string
+		data     []byte
+		limit    int
+		expected int
+		err      bool
+	}{
+		{name: "all frames", data: three, expected: 3},
+		{name: "under the limit", data: three, limit: 3, expected: 3},
+		{name: "stops over the limit", data: three, limit: 1, expected: 2},
+		{name: "single frame", data: animatedGif(1), expected: 1},
+		{name: "not a gif", data: []byte("\x89PNG\r\n\x1a\n0000000000"), err: true},
+		{name: "truncated header", data: []byte("GIF89a"), err: true},
+		{name: "truncated frames", data: three[:len(three)-10], expected: 2, err: true},
+	}
+	for _, tc := range cases {
+		frames, err := CountGifFrames(bytes.NewReader(tc.data), tc.limit)
+		if (err != nil) != tc.err {
+			t.Errorf("%s: expected an error %t, got %v", tc.name, tc.err, err)
+		}
+		if frames != tc.expected {
+			t.Errorf("%s: expected %d frames, got %d", tc.name, tc.expected, frames)
+		}
+	}
+
+	// a local color table and a comment extension spread over two sub-blocks
+	local := []byte("GIF87a\x01\x00\x01\x00\x00\x00\x00" +
+		"\x21\xfe\x02hi\x01!\x00" +
+		"\x2c\x00\x00\x00\x00\x01\x00\x01\x00\x80\x00\x00\x00\xff\xff\xff\x02\x02\x44\x01\x00" +
+		"\x3b")
+	if frames, err := CountGifFrames(bytes.NewReader(local), 0); err != nil || frames != 1 {
+		t.Errorf("local color table: expected 1 frame, got %d (%v)", frames, err)
+	}
+}
+
+func TestGifFrames(t *testing.T) {
+	data := animatedGif(5)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/gif")
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	f := Fetcher{}
+	if frames, err := f.GifFrames(context.Background(), ts.URL, 0); err != nil || frames != 5 {
+		t.Errorf("expected 5 frames, got %d (%v)", frames, err)
+	}
+	if frames, err := f.GifFrames(context.Background(), ts.URL, 2); err != nil || frames != 3 {
+		t.Errorf("expected the count to stop at 3 frames, got %d (%v)", frames, err)
+	}
+	f.MaxSize = len(data) / 2
+	if frames, err := f.GifFrames(context.Background(), ts.URL, 10); err == nil || frames >= 5 {
+		t.Errorf("expected a partial count of the gif over the size limit, got %d (%v)", frames, err)
+	}
+}
@@ -0,0 +1,14 @@
+package plugins
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// Define all metrics for the plugins framework here.
+	commandCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "lighthouse_plugin_commands_total",
+		Help: "The number of commands invoked by plugin, command name and action of the comment.",
+	}, []string{"plugin", "command", "action"})
+)
@@ -0,0 +1,150 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/robfig/cron.v2"
+	"k8s.io/utils/clock"
+)
+
+// Periodic is a task a plugin runs on the schedule found in the configuration
+type Periodic struct {
+	// Name tells the tasks of a plugin apart in the logs
+	Name string
+	// Schedule returns the cron schedule of the task, empty when it doesn't run
+	Schedule func(config *Configuration) string
+	// Handler runs the task
+	Handler PeriodicHandler
+}
+
+// zeroStep matches the steps of zero, which cron.Parse loops on forever
+var zeroStep = regexp.MustCompile(`/0+(,|\s|$)`)
+
+// parseSchedule parses the cron schedule of a task, in UTC unless it is
+// prefixed with a TZ= location. The schedules are checked every minute, so
+// the @every descriptors are not supported.
+func parseSchedule(spec string) (cron.Schedule, error) {
+	if zeroStep.MatchString(spec) {
+		return nil, fmt.Errorf("invalid schedule %q: a step must be positive", spec)
+	}
+	located := spec
+	if !strings.HasPrefix(spec, "TZ=") {
+		located = "TZ=UTC " + spec
+	}
+	schedule, err := cron.Parse(located)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+	}
+	if _, ok := schedule.(cron.ConstantDelaySchedule); ok {
+		return nil, fmt.Errorf("invalid schedule %q: @every is not supported", spec)
+	}
+	return schedule, nil
+}
+
+// Scheduler runs the periodic tasks of the plugins enabled in the
+// configuration, checking their schedules every minute.
+type Scheduler struct {
+	// Config returns the current plugin configuration
+	Config func() *Configuration
+	// Agent returns the agent the tasks run with
+	Agent func() (Agent, error)
+	// Plugins default to the registered plugins
+	Plugins map[string]Plugin
+	// Clock defaults to the real clock
+	Clock clock.WithTicker
+	// Logger defaults to the standard logger
+	Logger *logrus.Entry
+
+	last time.Time
+}
+
+// registered returns the plugins of the scheduler, or the registered ones
+func (s *Scheduler) registered() map[string]Plugin {
+	if s.Plugins == nil {
+		return plugins
+	}
+	return s.Plugins
+}
+
+// Run runs the tasks as they are due until the context is done
+func (s *Scheduler) Run(ctx context.Context) {
+	c := s.Clock
+	if c == nil {
+		c = clock.RealClock{}
+	}
+	ticker := c.NewTicker(time.Minute)
+	defer ticker.Stop()
+	s.last = c.Now().UTC().Truncate(time.Minute)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C():
+			s.runDue(ctx, now)
+		}
+	}
+}
+
+// maxCatchUp bounds the minutes a late check looks back at
+const maxCatchUp = time.Hour
+
+// runDue runs the tasks due in the minutes since the previous check, a late
+// tick still runs the tasks of the minutes it skipped, up to maxCatchUp, but
+// each minute runs once.
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) {
+	log := s.Logger
+	if log == nil {
+		log = logrus.NewEntry(logrus.StandardLogger())
+	}
+	now = now.UTC().Truncate(time.Minute)
+	from := s.last
+	if from.IsZero() || now.Sub(from) > maxCatchUp {
+		from = now.Add(-time.Minute)
+	}
+	if now.After(s.last) {
+		s.last = now
+	}
+	if !now.After(from) {
+		return
+	}
+	config := s.Config()
+	if config == nil {
+		return
+	}
+	for name, plugin := range s.registered() {
+		if orgs, repos := config.EnabledReposForPlugin(name); len(orgs) == 0 && len(repos) == 0 {
+			continue
+		}
+		for _, p := range plugin.Periodics {
+			l := log.WithFields(logrus.Fields{"plugin": name, "periodic": p.Name})
+			spec := p.Schedule(config)
+			if spec == "" {
+				continue
+			}
+			schedule, err := parseSchedule(spec)
+			if err != nil {
+				l.WithError(err).Error("Invalid schedule")
+				continue
+			}
+			// a task runs once however many of the minutes it missed
+			if next := schedule.Next(from); next.IsZero() || next.After(now) {
+				continue
+			}
+			agent, err := s.Agent()
+			if err != nil {
+				l.WithError(err).Error("Failed to create the agent of the periodic task")
+				continue
+			}
+			agent.Context = ctx
+			agent.Logger = l
+			if err := p.Handler(agent); err != nil {
+				l.WithError(err).Error("Error running the periodic task")
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package plugins
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestParseSchedule(t *testing.T) {
+	monday9am := time.Date(2024, time.May, 6, 9, 0, 0, 0, time.UTC)
+	cases := []struct {
+		spec     string
+		at       time.Time
+		expected bool
+		invalid  bool
+	}{
+		{spec: "* * * * *", at: monday9am, expected: true},
+		{spec: "0 9 * * 1-5", at: monday9am, expected: true},
+		{spec: "0 9 * * 1-5", at: monday9am.Add(24 * 5 * time.Hour)},
+		{spec: "0 9 * * 1-5", at: monday9am.Add(time.Minute)},
+		{spec: "*/15 9,17 * * *", at: monday9am.Add(45 * time.Minute), expected: true},
+		{spec: "*/15 9,17 * * *", at: monday9am.Add(50 * time.Minute)},
+		{spec: "0 9 6 * *", at: monday9am, expected: true},
+		{spec: "0 9 6 6 *", at: monday9am},
+		// either of the days is enough when both are restricted
+		{spec: "0 9 1 * 1", at: monday9am, expected: true},
+		{spec: "0 9 1 * 2", at: monday9am},
+		{spec: "0 9 * *", invalid: true},
+		{spec: "60 * * * *", invalid: true},
+		{spec: "* * 0 * *", invalid: true},
+		{spec: "5-1 * * * *", invalid: true},
+		{spec: "*/0 * * * *", invalid: true},
+		{spec: "noon * * * *", invalid: true},
+		{spec: "@daily", at: monday9am.Add(-9 * time.Hour), expected: true},
+		{spec: "@daily", at: monday9am},
+		{spec: "@every 1h", invalid: true},
+	}
+	for _, tc := range cases {
+		s, err := parseSchedule(tc.spec)
+		if tc.invalid {
+			if err == nil {
+				t.Errorf("%q: expected an error", tc.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.spec, err)
+			continue
+		}
+		if got := s.Next(tc.at.Add(-time.Minute)).Equal(tc.at); got != tc.expected {
+			t.Errorf("%q at %v: expected match %t, got %t", tc.spec, tc.at, tc.expected, got)
+		}
+	}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	start := time.Date(2024, time.May, 6, 8, 58, 30, 0, time.UTC)
+	clock := clocktesting.NewFakeClock(start)
+	ran := make(chan time.Time, 10)
+	config := &Configuration{Plugins: map[string][]string{"org/repo": {"scheduled"}}}
+	s := &Scheduler{
+		Config: func() *Configuration { return config },
+		Agent:  func() (Agent, error) { return Agent{}, nil },
+		Plugins: map[string]Plugin{
+			"scheduled": {Periodics: []Periodic{{
+				Name:     "nine",
+				Schedule: func(*Configuration) string { return "0 9 * * *" },
+				Handler: func(Agent) error {
+					ran <- clock.Now()
+					return nil
+				},
+			}}},
+			"disabled": {Periodics: []Periodic{{
+				Name:     "always",
+				Schedule: func(*Configuration) string { return "* * * * *" },
+				Handler: func(Agent) error {
+					t.Error("didn't expect a task of a disabled plugin to run")
+					return nil
+				},
+			}}},
+		},
+		Clock: clock,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	step := func() {
+		for !clock.HasWaiters() {
+			time.Sleep(time.Millisecond)
+		}
+		clock.Step(time.Minute)
+	}
+	// 8:59:30 isn't the time yet
+	step()
+	// 9:00:30 is
+	step()
+	select {
+	case at := <-ran:
+		if expected := start.Add(2 * time.Minute); !at.Equal(expected) {
+			t.Errorf("expected the task to run at %v, got %v", expected, at)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the task to run at 9:00")
+	}
+	step()
+	select {
+	case at := <-ran:
+		t.Errorf("expected the task to run once a day, it ran again at %v", at)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// a late check still runs the tasks of the minutes it skipped, only once
+	late := &Scheduler{Config: s.Config, Agent: s.Agent, Plugins: s.Plugins, last: time.Date(2024, time.May, 7, 8, 55, 0, 0, time.UTC)}
+	late.runDue(ctx, time.Date(2024, time.May, 7, 9, 3, 0, 0, time.UTC))
+	if len(ran) != 1 {
+		t.Errorf("expected the missed task to run once, it ran %d times", len(ran))
+	}
+}
+
+func TestSchedulerPicksUpNewSchedules(t *testing.T) {
+	schedule := ""
+	ran := 0
+	s := &Scheduler{
+		Config: func() *Configuration { return &Configuration{Plugins: map[string][]string{"org/repo": {"scheduled"}}} },
+		Agent:  func() (Agent, error) { return Agent{}, nil },
+		Plugins: map[string]Plugin{
+			"scheduled": {Periodics: []Periodic{{
+				Name:     "nine",
+				Schedule: func(*Configuration) string { return schedule },
+				Handler: func(Agent) error {
+					ran++
+					return nil
+				},
+			}}},
+		},
+	}
+	ctx := context.Background()
+	nine := time.Date(2024, time.May, 6, 9, 0, 0, 0, time.UTC)
+	s.runDue(ctx, nine)
+	if ran != 0 {
+		t.Fatalf("expected nothing to run without a schedule, %d tasks ran", ran)
+	}
+	// a schedule configured once the scheduler is running needs no restart
+	schedule = "1 9 * * *"
+	s.runDue(ctx, nine.Add(time.Minute))
+	if ran != 1 {
+		t.Errorf("expected the new schedule to run, %d tasks ran", ran)
+	}
+}
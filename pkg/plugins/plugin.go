@@ -11,6 +11,7 @@ type Plugin struct {
 	Description           string
 	ExcludedProviders     sets.String
 	ConfigHelpProvider    ConfigHelpProvider
+	HealthProvider        HealthProvider
 	IssueHandler          IssueHandler
 	PullRequestHandler    PullRequestHandler
 	PushEventHandler      PushEventHandler
@@ -18,6 +19,7 @@ type Plugin struct {
 	StatusEventHandler    StatusEventHandler
 	GenericCommentHandler GenericCommentHandler
 	Commands              []Command
+	Periodics             []Periodic
 }
 
 // InvokeCommandHandler calls InvokeHandler on all commands
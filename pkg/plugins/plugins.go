@@ -17,6 +17,7 @@ limitations under the License.
 package plugins
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/url"
@@ -54,6 +55,9 @@ type HelpProvider func(config *Configuration, enabledRepos []string) (*pluginhel
 // ConfigHelpProvider defines the function type that constructs help about a plugin configuration.
 type ConfigHelpProvider func(config *Configuration, enabledRepos []string) (map[string]string, error)
 
+// HealthProvider defines the function type that checks whether the upstream dependencies of a plugin are available.
+type HealthProvider func(config *Configuration) error
+
 // IssueHandler defines the function contract for a scm.Issue handler.
 type IssueHandler func(Agent, scm.Issue) error
 
@@ -75,6 +79,25 @@ type GenericCommentHandler func(Agent, scmprovider.GenericCommentEvent) error
 // CommandEventHandler defines the function contract for a command handler.
 type CommandEventHandler func(CommandMatch, Agent, scmprovider.GenericCommentEvent) error
 
+// PeriodicHandler defines the function contract for a task run on a schedule.
+type PeriodicHandler func(Agent) error
+
+// CheckHealth runs the HealthProvider of every plugin enabled in the configuration,
+// returning the result of each check by plugin name.
+func CheckHealth(config *Configuration) map[string]error {
+	results := map[string]error{}
+	for name, plugin := range plugins {
+		if plugin.HealthProvider == nil {
+			continue
+		}
+		if orgs, repos := config.EnabledReposForPlugin(name); len(orgs) == 0 && len(repos) == 0 {
+			continue
+		}
+		results[name] = plugin.HealthProvider(config)
+	}
+	return results
+}
+
 // HelpProviders returns the map of registered plugins with their associated HelpProvider.
 func HelpProviders() map[string]HelpProvider {
 	pluginHelp := make(map[string]HelpProvider)
@@ -110,6 +133,10 @@ type Agent struct {
 
 	// may be nil if not initialized
 	Commentpruner *commentpruner.EventClient
+
+	// Context is cancelled when the event no longer needs handling,
+	// may be nil in which case handlers use context.Background()
+	Context context.Context
 }
 
 // NewAgent bootstraps a new Agent struct from the passed dependencies.
@@ -117,6 +144,7 @@ func NewAgent(configAgent *config.Agent, pluginConfigAgent *ConfigAgent, clientA
 	prowConfig := configAgent.Config()
 	pluginConfig := pluginConfigAgent.Config()
 	scmClient := scmprovider.ToClient(clientAgent.SCMProviderClient, clientAgent.BotName)
+	scmClient.SetDryRun(clientAgent.DryRun)
 	return Agent{
 		SCMProviderClient: scmClient,
 		GitClient:         clientAgent.GitClient,
@@ -161,6 +189,8 @@ func (a *Agent) CommentPruner() (*commentpruner.EventClient, error) {
 type ClientAgent struct {
 	BotName           string
 	SCMProviderClient *scm.Client
+	// DryRun logs the comments the plugins would create instead of creating them
+	DryRun bool
 
 	KubernetesClient kubernetes.Interface
 	GitClient        git.Client
@@ -17,6 +17,8 @@ limitations under the License.
 package plugins
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 
 	"sigs.k8s.io/yaml"
@@ -153,3 +155,31 @@ func TestGetPlugins(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckHealth(t *testing.T) {
+	unhealthy := errors.New("upstream is down")
+	RegisterPlugin("healthy-plugin", Plugin{HealthProvider: func(*Configuration) error { return nil }})
+	RegisterPlugin("unhealthy-plugin", Plugin{HealthProvider: func(*Configuration) error { return unhealthy }})
+	RegisterPlugin("disabled-plugin", Plugin{HealthProvider: func(*Configuration) error { return unhealthy }})
+	RegisterPlugin("no-health-plugin", Plugin{})
+	defer func() {
+		for _, name := range []string{"healthy-plugin", "unhealthy-plugin", "disabled-plugin", "no-health-plugin"} {
+			delete(plugins, name)
+		}
+	}()
+
+	config := &Configuration{
+		Plugins: map[string][]string{
+			"org":      {"healthy-plugin", "no-health-plugin"},
+			"org/repo": {"unhealthy-plugin"},
+		},
+	}
+	results := CheckHealth(config)
+	expected := map[string]error{
+		"healthy-plugin":   nil,
+		"unhealthy-plugin": unhealthy,
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected health %v, got %v", expected, results)
+	}
+}
@@ -19,8 +19,10 @@ package plugins
 import (
 	"fmt"
 	"strings"
+	"text/template"
 
 	"github.com/jenkins-x/go-scm/scm"
+	"github.com/sirupsen/logrus"
 )
 
 // AboutThisBotWithoutCommands contains the message that explains how to interact with the bot.
@@ -70,10 +72,64 @@ func FormatResponseRaw(body, bodyURL, login, reply string) string {
 
 %s
 `
-	// Quote the user's comment by prepending ">" to each line.
+	return FormatResponse(login, reply, fmt.Sprintf(format, bodyURL, quote(body)))
+}
+
+// quote quotes the user's comment by prepending ">" to each line.
+func quote(body string) string {
 	var quoted []string
 	for _, l := range strings.Split(body, "\n") {
 		quoted = append(quoted, ">"+l)
 	}
-	return FormatResponse(login, reply, fmt.Sprintf(format, bodyURL, strings.Join(quoted, "\n")))
+	return strings.Join(quoted, "\n")
+}
+
+// ResponseFormatter formats a reply to a comment like FormatResponseRaw
+type ResponseFormatter func(body, bodyURL, login, reply string) string
+
+// ResponseData is the data available to a response template
+type ResponseData struct {
+	// Login is the author being replied to
+	Login string
+	// Reply is the message of the plugin
+	Reply string
+	// Body is the comment being replied to
+	Body string
+	// Quoted is the comment being replied to with each line quoted
+	Quoted string
+	// BodyURL links to the comment being replied to
+	BodyURL string
+	// AboutThisBot explains how to interact with the bot
+	AboutThisBot string
+}
+
+// FormatResponseTemplate formats a response with the template
+func FormatResponseTemplate(tmpl *template.Template, body, bodyURL, login, reply string) (string, error) {
+	var out strings.Builder
+	err := tmpl.Execute(&out, ResponseData{
+		Login:        login,
+		Reply:        reply,
+		Body:         body,
+		Quoted:       quote(body),
+		BodyURL:      bodyURL,
+		AboutThisBot: AboutThisBotWithoutCommands,
+	})
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// FormatResponseRaw formats a response with the configured response template,
+// falling back to the default format when there is none or it fails to render.
+func (c *Configuration) FormatResponseRaw(body, bodyURL, login, reply string) string {
+	if c == nil || c.ResponseTmpl == nil {
+		return FormatResponseRaw(body, bodyURL, login, reply)
+	}
+	out, err := FormatResponseTemplate(c.ResponseTmpl, body, bodyURL, login, reply)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to render the response template, using the default format")
+		return FormatResponseRaw(body, bodyURL, login, reply)
+	}
+	return out
 }
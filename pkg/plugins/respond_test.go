@@ -54,3 +54,63 @@ func TestFormatResponseRaw(t *testing.T) {
 		t.Errorf("Expected quotes, got:\n%s", out)
 	}
 }
+
+func TestConfigurationFormatResponseRaw(t *testing.T) {
+	body := "/meow\nplease"
+	cases := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{
+			name:     "default",
+			expected: FormatResponseRaw(body, "link", "ca", "![cat](cat.jpg)"),
+		},
+		{
+			name: "custom",
+			template: `<details><summary>@{{.Login}} asked for this</summary>
+
+{{.Reply}}
+</details>
+
+[source]({{.BodyURL}}) of {{printf "%q" .Body}}`,
+			expected: `<details><summary>@ca asked for this</summary>
+
+![cat](cat.jpg)
+</details>
+
+[source](link) of "/meow\nplease"`,
+		},
+		{
+			name:     "quoted",
+			template: `{{.Quoted}}`,
+			expected: ">/meow\n>please",
+		},
+		{
+			name:     "fails to render",
+			template: `{{.Missing}}`,
+			expected: FormatResponseRaw(body, "link", "ca", "![cat](cat.jpg)"),
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Configuration{ResponseTemplate: tc.template}
+			c.setDefaults()
+			if err := compileRegexpsAndDurations(c); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out := c.FormatResponseRaw(body, "link", "ca", "![cat](cat.jpg)")
+			if out != tc.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, out)
+			}
+		})
+	}
+}
+
+func TestInvalidResponseTemplate(t *testing.T) {
+	c := &Configuration{ResponseTemplate: "{{.Reply"}
+	c.setDefaults()
+	if err := compileRegexpsAndDurations(c); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+}
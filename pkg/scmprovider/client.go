@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"regexp"
 
 	"github.com/jenkins-x/go-scm/scm"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -30,6 +31,7 @@ type SCMClient interface {
 	// Functions implemented in content.go
 	GetFile(string, string, string, string) ([]byte, error)
 	ListFiles(string, string, string, string) ([]*scm.FileEntry, error)
+	UploadFile(string, string, string, []byte) (string, error)
 
 	// Functions implemented in git.go
 	GetRef(string, string, string) (string, error)
@@ -49,6 +51,9 @@ type SCMClient interface {
 	ListIssueComments(string, string, int) ([]*scm.Comment, error)
 	GetIssueLabels(string, string, int, bool) ([]*scm.Label, error)
 	CreateComment(string, string, int, bool, string) error
+	CreateCommentReply(string, string, int, bool, string, string) error
+	CreateCommentReaction(string, string, int, int, bool, string) error
+	ListCommentReactions(string, string, int, int, bool) ([]string, error)
 	ReopenIssue(string, string, int) error
 	FindIssues(string, string, bool) ([]scm.Issue, error)
 	CloseIssue(string, string, int) error
@@ -98,6 +103,12 @@ type SCMClient interface {
 type Client struct {
 	client  *scm.Client
 	botName string
+	dryRun  bool
+}
+
+// SetDryRun makes CreateComment log the comment instead of creating it
+func (c *Client) SetDryRun(dryRun bool) {
+	c.dryRun = dryRun
 }
 
 // ToScmClient gets the underlying SCM client
@@ -128,12 +139,27 @@ func (c *Client) SupportsPRLabels() bool {
 	return !NoLabelProviders().Has(c.ProviderType())
 }
 
+// bitbucketAccountID matches the account ids of Bitbucket Cloud, e.g.
+// 557058:c0b7ab22-... or 5b10a2844c20165700ede21g
+var bitbucketAccountID = regexp.MustCompile(`^(?:\d+:[0-9a-fA-F-]+|[0-9a-fA-F]{24})$`)
+
 // QuoteAuthorForComment will quote the author login for use in "@author" if appropriate for the provider.
+// GitHub, GitLab and Gitea mention the login as is, Bitbucket Server needs it in
+// quotes and Bitbucket Cloud mentions the account id in braces, see
+// GenericCommentEvent.AuthorMention. Bitbucket Cloud logins that aren't account
+// ids are left as is.
 func (c *Client) QuoteAuthorForComment(author string) string {
-	if c.ProviderType() == "stash" {
+	switch c.client.Driver {
+	case scm.DriverStash:
 		return `"` + author + `"`
+	case scm.DriverBitbucket:
+		if bitbucketAccountID.MatchString(author) {
+			return "{" + author + "}"
+		}
+		return author
+	default:
+		return author
 	}
-	return author
 }
 
 // ServerURL returns the server URL for the client
@@ -0,0 +1,363 @@
+package scmprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/go-scm/scm/driver/fake"
+)
+
+func TestQuoteAuthorForComment(t *testing.T) {
+	testcases := []struct {
+		driver   scm.Driver
+		author   string
+		expected string
+	}{
+		{driver: scm.DriverGithub, author: "octocat", expected: "octocat"},
+		{driver: scm.DriverGitlab, author: "tanuki", expected: "tanuki"},
+		{driver: scm.DriverGitea, author: "tea", expected: "tea"},
+		{driver: scm.DriverStash, author: "jane.doe", expected: `"jane.doe"`},
+		{driver: scm.DriverBitbucket, author: "557058:c0b7ab22", expected: "{557058:c0b7ab22}"},
+		{driver: scm.DriverBitbucket, author: "5b10a2844c20165700ede21a", expected: "{5b10a2844c20165700ede21a}"},
+		{driver: scm.DriverBitbucket, author: "{d4c2ab38-4d8a-4ad0-9c2e-8f2b5a1b0e7c}", expected: "{d4c2ab38-4d8a-4ad0-9c2e-8f2b5a1b0e7c}"},
+		{driver: scm.DriverBitbucket, author: "octocat", expected: "octocat"},
+	}
+	for _, tc := range testcases {
+		c := ToClient(&scm.Client{Driver: tc.driver}, "bot")
+		if got := c.QuoteAuthorForComment(tc.author); got != tc.expected {
+			t.Errorf("%s: expected %q for %q, got %q", tc.driver, tc.expected, tc.author, got)
+		}
+	}
+}
+
+func TestAuthorMention(t *testing.T) {
+	c := ToClient(&scm.Client{Driver: scm.DriverBitbucket}, "bot")
+	e := &GenericCommentEvent{Author: scm.User{Login: "octocat"}}
+	if got := c.QuoteAuthorForComment(e.AuthorMention()); got != "octocat" {
+		t.Errorf("expected the login without an account id, got %q", got)
+	}
+	e.AuthorAccountID = "557058:c0b7ab22-3c0c-4c5b-8f3e-8b0e2d0e7c1a"
+	if got := c.QuoteAuthorForComment(e.AuthorMention()); got != "{557058:c0b7ab22-3c0c-4c5b-8f3e-8b0e2d0e7c1a}" {
+		t.Errorf("expected the account id in braces, got %q", got)
+	}
+}
+
+func TestDryRunCreateComment(t *testing.T) {
+	for _, pr := range []bool{false, true} {
+		fakeScmClient, fc := fake.NewDefault()
+		c := ToClient(fakeScmClient, "bot")
+		c.SetDryRun(true)
+		if err := c.CreateComment("org", "repo", 5, pr, "hello"); err != nil {
+			t.Fatalf("pr %t: unexpected error: %v", pr, err)
+		}
+		if len(fc.IssueComments[5]) != 0 || len(fc.PullRequestComments[5]) != 0 {
+			t.Errorf("pr %t: expected no comment to be created in a dry run", pr)
+		}
+
+		c.SetDryRun(false)
+		if err := c.CreateComment("org", "repo", 5, pr, "hello"); err != nil {
+			t.Fatalf("pr %t: unexpected error: %v", pr, err)
+		}
+		if len(fc.IssueComments[5])+len(fc.PullRequestComments[5]) != 1 {
+			t.Errorf("pr %t: expected the comment to be created", pr)
+		}
+	}
+}
+
+func TestCreateCommentReplyInThread(t *testing.T) {
+	for _, pr := range []bool{false, true} {
+		var path, body string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.EscapedPath()
+			payload := map[string]string{}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				t.Errorf("pr %t: invalid payload: %v", pr, err)
+			}
+			body = payload["body"]
+			w.WriteHeader(http.StatusCreated)
+		}))
+		u, _ := url.Parse(server.URL + "/")
+		c := ToClient(&scm.Client{Driver: scm.DriverGitlab, BaseURL: u}, "bot")
+		if err := c.CreateCommentReply("org", "repo", 5, pr, "abc123", "hello"); err != nil {
+			t.Fatalf("pr %t: unexpected error: %v", pr, err)
+		}
+		server.Close()
+		expected := "/api/v4/projects/org%2Frepo/issues/5/discussions/abc123/notes"
+		if pr {
+			expected = "/api/v4/projects/org%2Frepo/merge_requests/5/discussions/abc123/notes"
+		}
+		if path != expected {
+			t.Errorf("pr %t: expected reply to %s, got %s", pr, expected, path)
+		}
+		if body != "hello" {
+			t.Errorf("pr %t: expected body %q, got %q", pr, "hello", body)
+		}
+	}
+}
+
+func TestCreateCommentReplyFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL + "/")
+	c := ToClient(&scm.Client{Driver: scm.DriverGitlab, BaseURL: u}, "bot")
+	if err := c.CreateCommentReply("org", "repo", 5, false, "abc123", "hello"); err == nil {
+		t.Error("expected an error when the thread doesn't exist")
+	}
+}
+
+func TestCreateCommentReplyFallback(t *testing.T) {
+	testcases := []struct {
+		name     string
+		driver   scm.Driver
+		threadID string
+	}{
+		{name: "no threads", driver: scm.DriverFake, threadID: "abc123"},
+		{name: "no thread id", driver: scm.DriverGitlab},
+	}
+	for _, tc := range testcases {
+		for _, pr := range []bool{false, true} {
+			fakeScmClient, fc := fake.NewDefault()
+			fakeScmClient.Driver = tc.driver
+			c := ToClient(fakeScmClient, "bot")
+			if err := c.CreateCommentReply("org", "repo", 5, pr, tc.threadID, "hello"); err != nil {
+				t.Fatalf("%s, pr %t: unexpected error: %v", tc.name, pr, err)
+			}
+			comments := fc.IssueComments[5]
+			if pr {
+				comments = fc.PullRequestComments[5]
+			}
+			if len(comments) != 1 || comments[0].Body != "hello" {
+				t.Errorf("%s, pr %t: expected a top level comment, got %v", tc.name, pr, comments)
+			}
+		}
+	}
+}
+
+func TestDryRunCreateCommentReply(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL + "/")
+	c := ToClient(&scm.Client{Driver: scm.DriverGitlab, BaseURL: u}, "bot")
+	c.SetDryRun(true)
+	if err := c.CreateCommentReply("org", "repo", 5, true, "abc123", "hello"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if called {
+		t.Error("expected no reply to be created in a dry run")
+	}
+}
+
+func TestDryRunDeleteComment(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL + "/")
+	c := ToClient(&scm.Client{Driver: scm.DriverGitlab, BaseURL: u}, "bot")
+	c.SetDryRun(true)
+	for _, pr := range []bool{true, false} {
+		if err := c.DeleteComment("org", "repo", 5, 7, pr); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if called {
+		t.Error("expected no comment to be deleted in a dry run")
+	}
+}
+
+func TestUploadFile(t *testing.T) {
+	var path, name string
+	var content []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("expected a file to be uploaded: %v", err)
+			return
+		}
+		defer file.Close()
+		name = header.Filename
+		content, _ = io.ReadAll(file)
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"url":"/uploads/abc/cat.jpg","full_path":"/org/repo/uploads/abc/cat.jpg"}`)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL + "/")
+	c := ToClient(&scm.Client{Driver: scm.DriverGitlab, BaseURL: u}, "bot")
+	hosted, err := c.UploadFile("org", "repo", "cat.jpg", []byte("meow"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := server.URL + "/org/repo/uploads/abc/cat.jpg"; hosted != expected {
+		t.Errorf("expected the file to be hosted at %s, got %s", expected, hosted)
+	}
+	if path != "/api/v4/projects/org%2Frepo/uploads" || name != "cat.jpg" || string(content) != "meow" {
+		t.Errorf("unexpected upload of %q to %s: %q", name, path, content)
+	}
+
+	c.SetDryRun(true)
+	path = ""
+	if _, err := c.UploadFile("org", "repo", "cat.jpg", []byte("meow")); err == nil || path != "" {
+		t.Errorf("expected nothing to be uploaded in a dry run, got %v", err)
+	}
+
+	fakeScmClient, _ := fake.NewDefault()
+	if _, err := ToClient(fakeScmClient, "bot").UploadFile("org", "repo", "cat.jpg", []byte("meow")); !errors.Is(err, scm.ErrNotSupported) {
+		t.Errorf("expected uploads not to be supported, got %v", err)
+	}
+}
+
+func TestListCommentReactions(t *testing.T) {
+	testcases := []struct {
+		driver   scm.Driver
+		pr       bool
+		path     string
+		response string
+	}{
+		{
+			driver:   scm.DriverGithub,
+			pr:       true,
+			path:     "/repos/org/repo/issues/comments/7/reactions",
+			response: `[{"content":"-1"},{"content":"eyes"}]`,
+		},
+		{
+			driver:   scm.DriverGitlab,
+			path:     "/api/v4/projects/org%2Frepo/issues/5/notes/7/award_emoji",
+			response: `[{"name":"thumbsdown"},{"name":"eyes"}]`,
+		},
+		{
+			driver:   scm.DriverGitlab,
+			pr:       true,
+			path:     "/api/v4/projects/org%2Frepo/merge_requests/5/notes/7/award_emoji",
+			response: `[{"name":"thumbsdown"},{"name":"eyes"}]`,
+		},
+	}
+	for _, tc := range testcases {
+		var path string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.EscapedPath()
+			io.WriteString(w, tc.response)
+		}))
+		u, _ := url.Parse(server.URL + "/")
+		c := ToClient(&scm.Client{Driver: tc.driver, BaseURL: u}, "bot")
+		reactions, err := c.ListCommentReactions("org", "repo", 5, 7, tc.pr)
+		server.Close()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.driver, err)
+		}
+		if path != tc.path {
+			t.Errorf("%s: expected the reactions from %s, got %s", tc.driver, tc.path, path)
+		}
+		if len(reactions) != 2 || reactions[0] != "-1" || reactions[1] != "eyes" {
+			t.Errorf("%s: unexpected reactions %v", tc.driver, reactions)
+		}
+	}
+
+	fakeScmClient, _ := fake.NewDefault()
+	if _, err := ToClient(fakeScmClient, "bot").ListCommentReactions("org", "repo", 5, 7, false); !errors.Is(err, scm.ErrNotSupported) {
+		t.Errorf("expected reactions not to be supported, got %v", err)
+	}
+}
+
+func TestImageDetailsTooBig(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Content-Length", "12345")
+	}))
+	defer ts.Close()
+
+	for limit, expected := range map[int]bool{20000: false, 12345: false, 10000: true} {
+		details, err := GetImageDetailsWithOptions(context.Background(), ts.URL+"/cat.jpg", ImageOptions{Limit: limit})
+		if err != nil {
+			t.Fatalf("limit %d: unexpected error: %v", limit, err)
+		}
+		if tooBig := details.TooBig(limit); tooBig != expected || details.Size != 12345 {
+			t.Errorf("limit %d: expected too big %t with 12345 bytes, got %t with %d bytes", limit, expected, tooBig, details.Size)
+		}
+	}
+	if tooBig, err := ImageTooBig(ts.URL + "/cat.jpg"); err != nil || tooBig {
+		t.Errorf("expected the image to fit the default limit, got %t (%v)", tooBig, err)
+	}
+}
+
+func TestImageDetailsRedirects(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cat.jpg":
+			http.Redirect(w, r, "/hop.jpg", http.StatusFound)
+		case "/hop.jpg":
+			http.Redirect(w, r, "/cdn/cat.jpg", http.StatusFound)
+		case "/cdn/cat.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Header().Set("Content-Length", "12345")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	for _, strategy := range []ImageSizeStrategy{ImageSizeHead, ImageSizeRange} {
+		details, err := GetImageDetailsWithOptions(context.Background(), ts.URL+"/cat.jpg", ImageOptions{Strategy: strategy})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", strategy, err)
+		}
+		if details.URL != ts.URL+"/cdn/cat.jpg" || details.Size != 12345 {
+			t.Errorf("%s: expected the 12345 bytes at the end of the redirects, got %d bytes at %s", strategy, details.Size, details.URL)
+		}
+	}
+	details, err := GetImageDetailsWithOptions(context.Background(), ts.URL+"/cdn/cat.jpg", ImageOptions{})
+	if err != nil || details.URL != ts.URL+"/cdn/cat.jpg" {
+		t.Errorf("expected the requested url without redirects, got %s (%v)", details.URL, err)
+	}
+	if _, err := GetImageDetailsWithOptions(context.Background(), ts.URL+"/cat.jpg", ImageOptions{MaxRedirects: 1}); err == nil {
+		t.Error("expected an error for more redirects than allowed")
+	}
+}
+
+func TestImageDetailsMaxRedirects(t *testing.T) {
+	// /hops/<n> is n requests away from the image
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hops/"))
+		if err != nil || n < 1 {
+			http.NotFound(w, r)
+			return
+		}
+		if n > 1 {
+			http.Redirect(w, r, fmt.Sprintf("/hops/%d", n-1), http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Content-Length", "12345")
+	}))
+	defer ts.Close()
+
+	for _, max := range []int{1, 3, 0} {
+		allowed := max
+		if allowed <= 0 {
+			allowed = DefaultMaxRedirects
+		}
+		opts := ImageOptions{MaxRedirects: max}
+		if _, err := GetImageDetailsWithOptions(context.Background(), fmt.Sprintf("%s/hops/%d", ts.URL, allowed), opts); err != nil {
+			t.Errorf("max %d: expected %d hops to the image to be followed, got %v", max, allowed, err)
+		}
+		if _, err := GetImageDetailsWithOptions(context.Background(), fmt.Sprintf("%s/hops/%d", ts.URL, allowed+1), opts); err == nil {
+			t.Errorf("max %d: expected %d hops to the image to fail", max, allowed+1)
+		}
+	}
+}
@@ -1,9 +1,17 @@
 package scmprovider
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
 
 	"github.com/jenkins-x/go-scm/scm"
+	"github.com/sirupsen/logrus"
 )
 
 // GetFile returns the file from git
@@ -29,3 +37,56 @@ func (c *Client) ListFiles(owner, repo, filepath, commit string) ([]*scm.FileEnt
 	answer, _, err := c.client.Contents.List(ctx, fullName, filepath, commit)
 	return answer, err
 }
+
+// UploadFile attaches the file to the repository and returns the url it is
+// hosted at, for providers that host uploads referenced from comments.
+// Only GitLab is supported, other providers return scm.ErrNotSupported.
+func (c *Client) UploadFile(owner, repo, name string, content []byte) (string, error) {
+	if c.client.Driver != scm.DriverGitlab {
+		return "", scm.ErrNotSupported
+	}
+	fullName := c.repositoryName(owner, repo)
+	if c.dryRun {
+		logrus.WithFields(logrus.Fields{"repo": fullName, "file": name}).Info("dry run, not uploading file")
+		return "", errors.New("dry run, file not uploaded")
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(content); err != nil {
+		return "", err
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+	response, err := c.client.Do(context.Background(), &scm.Request{
+		Method: http.MethodPost,
+		Path:   fmt.Sprintf("api/v4/projects/%s/uploads", url.PathEscape(fullName)),
+		Header: http.Header{"Content-Type": []string{form.FormDataContentType()}},
+		Body:   &body,
+	})
+	if err != nil {
+		return "", connectErrorHandle(response, err)
+	}
+	defer response.Body.Close()
+	if response.Status < 200 || response.Status > 299 {
+		return "", connectErrorHandle(response, fmt.Errorf("failed to upload %s", name))
+	}
+	var uploaded struct {
+		FullPath string `json:"full_path"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&uploaded); err != nil {
+		return "", fmt.Errorf("could not decode the upload of %s: %w", name, err)
+	}
+	if uploaded.FullPath == "" {
+		return "", fmt.Errorf("no url returned for the upload of %s", name)
+	}
+	hosted, err := c.client.BaseURL.Parse(uploaded.FullPath)
+	if err != nil {
+		return "", fmt.Errorf("invalid url returned for the upload of %s: %w", name, err)
+	}
+	return hosted.String(), nil
+}
@@ -3,8 +3,11 @@ package scmprovider
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/jenkins-x/go-scm/scm"
@@ -135,6 +138,10 @@ func (c *Client) RemoveLabel(owner, repo string, number int, label string, pr bo
 func (c *Client) DeleteComment(org, repo string, number, ID int, pr bool) error {
 	ctx := context.Background()
 	fullName := c.repositoryName(org, repo)
+	if c.dryRun {
+		logrus.WithFields(logrus.Fields{"repo": fullName, "number": number, "pr": pr}).Infof("dry run, not deleting comment %d", ID)
+		return nil
+	}
 	if pr {
 		_, err := c.client.PullRequests.DeleteComment(ctx, fullName, number, ID)
 		return err
@@ -232,6 +239,10 @@ func (c *Client) GetIssueLabels(org, repo string, number int, pr bool) ([]*scm.L
 // CreateComment create a comment
 func (c *Client) CreateComment(owner, repo string, number int, pr bool, comment string) error {
 	fullName := c.repositoryName(owner, repo)
+	if c.dryRun {
+		logrus.WithFields(logrus.Fields{"repo": fullName, "number": number, "pr": pr}).Infof("dry run, not creating comment: %s", comment)
+		return nil
+	}
 	commentInput := scm.CommentInput{
 		Body: comment,
 	}
@@ -251,6 +262,115 @@ func (c *Client) CreateComment(owner, repo string, number int, pr bool, comment
 	return nil
 }
 
+// CreateCommentReply replies within the discussion thread of a comment on providers
+// with threaded discussions, a new comment is created for other providers or when
+// there is no thread.
+func (c *Client) CreateCommentReply(owner, repo string, number int, pr bool, threadID, comment string) error {
+	if threadID == "" || c.client.Driver != scm.DriverGitlab {
+		return c.CreateComment(owner, repo, number, pr, comment)
+	}
+	fullName := c.repositoryName(owner, repo)
+	if c.dryRun {
+		logrus.WithFields(logrus.Fields{"repo": fullName, "number": number, "pr": pr, "thread": threadID}).Infof("dry run, not creating reply: %s", comment)
+		return nil
+	}
+	kind := "issues"
+	if pr {
+		kind = "merge_requests"
+	}
+	body, err := json.Marshal(map[string]string{"body": comment})
+	if err != nil {
+		return err
+	}
+	response, err := c.client.Do(context.Background(), &scm.Request{
+		Method: http.MethodPost,
+		Path:   fmt.Sprintf("api/v4/projects/%s/%s/%d/discussions/%s/notes", url.PathEscape(fullName), kind, number, url.PathEscape(threadID)),
+		Header: http.Header{"Content-Type": []string{"application/json"}},
+		Body:   bytes.NewReader(body),
+	})
+	if err != nil {
+		return connectErrorHandle(response, err)
+	}
+	defer response.Body.Close()
+	if response.Status < 200 || response.Status > 299 {
+		return connectErrorHandle(response, fmt.Errorf("failed to reply to thread %s", threadID))
+	}
+	return nil
+}
+
+// CreateCommentReaction adds a reaction, such as "eyes", to a comment
+func (c *Client) CreateCommentReaction(owner, repo string, number, id int, pr bool, reaction string) error {
+	fullName := c.repositoryName(owner, repo)
+	if c.dryRun {
+		logrus.WithFields(logrus.Fields{"repo": fullName, "number": number, "pr": pr}).Infof("dry run, not adding reaction %s to comment %d", reaction, id)
+		return nil
+	}
+	ctx := context.Background()
+	var response *scm.Response
+	var err error
+	if pr {
+		response, err = c.client.PullRequests.CreateCommentReaction(ctx, fullName, number, id, reaction)
+	} else {
+		response, err = c.client.Issues.CreateCommentReaction(ctx, fullName, number, id, reaction)
+	}
+	if err != nil {
+		return connectErrorHandle(response, err)
+	}
+	return nil
+}
+
+// ListCommentReactions returns the reactions on the comment, named as on
+// GitHub, e.g. "-1" for a thumbs down. Only GitHub and GitLab are supported,
+// other providers return scm.ErrNotSupported.
+func (c *Client) ListCommentReactions(owner, repo string, number, id int, pr bool) ([]string, error) {
+	fullName := c.repositoryName(owner, repo)
+	var path, field string
+	switch c.client.Driver {
+	case scm.DriverGithub:
+		// the comments on a pull request conversation are issue comments
+		path = fmt.Sprintf("repos/%s/issues/comments/%d/reactions", fullName, id)
+		field = "content"
+	case scm.DriverGitlab:
+		kind := "issues"
+		if pr {
+			kind = "merge_requests"
+		}
+		path = fmt.Sprintf("api/v4/projects/%s/%s/%d/notes/%d/award_emoji", url.PathEscape(fullName), kind, number, id)
+		field = "name"
+	default:
+		return nil, scm.ErrNotSupported
+	}
+	response, err := c.client.Do(context.Background(), &scm.Request{
+		Method: http.MethodGet,
+		Path:   path,
+	})
+	if err != nil {
+		return nil, connectErrorHandle(response, err)
+	}
+	defer response.Body.Close()
+	if response.Status < 200 || response.Status > 299 {
+		return nil, connectErrorHandle(response, fmt.Errorf("failed to list the reactions on comment %d", id))
+	}
+	var list []map[string]interface{}
+	if err := json.NewDecoder(response.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("could not decode the reactions on comment %d: %w", id, err)
+	}
+	reactions := make([]string, 0, len(list))
+	for _, r := range list {
+		name, _ := r[field].(string)
+		switch name {
+		case "":
+			continue
+		case "thumbsup":
+			name = "+1"
+		case "thumbsdown":
+			name = "-1"
+		}
+		reactions = append(reactions, name)
+	}
+	return reactions, nil
+}
+
 // EditComment edit a comment
 func (c *Client) EditComment(owner, repo string, number int, id int, comment string, pr bool) error {
 	fullName := c.repositoryName(owner, repo)
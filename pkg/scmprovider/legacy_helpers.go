@@ -1,7 +1,10 @@
 package scmprovider
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
@@ -77,23 +80,169 @@ var (
 	FoundingYear, _ = time.Parse(SearchTimeFormat, "2007-01-01T00:00:00Z")
 )
 
+// DefaultImageSizeLimit is the largest image size in bytes that GitHub will render (10MB)
+const DefaultImageSizeLimit = 10000000
+
+// DefaultMaxRedirects is the number of redirects followed to an image, as many as Go's http client
+const DefaultMaxRedirects = 10
+
 // ImageTooBig checks if image is bigger than github limits
 func ImageTooBig(url string) (bool, error) {
-	// limit is 10MB
-	limit := 10000000
-	// try to get the image size from Content-Length header
-	resp, err := http.Head(url) // #nosec
+	details, err := GetImageDetailsWithOptions(context.Background(), url, ImageOptions{})
+	if err != nil {
+		return true, err
+	}
+	return details.TooBig(DefaultImageSizeLimit), nil
+}
+
+// ImageDetails describes the size and type of an image
+type ImageDetails struct {
+	// Size is the size of the image in bytes, zero if unknown
+	Size int
+	// ContentType is the Content-Type of the image
+	ContentType string
+	// URL is where the image was found after following the redirects
+	URL string
+}
+
+// TooBig checks if the image is bigger than the given limit in bytes.
+// A limit of zero or less falls back to DefaultImageSizeLimit.
+func (d ImageDetails) TooBig(limit int) bool {
+	if limit <= 0 {
+		limit = DefaultImageSizeLimit
+	}
+	return d.Size > limit
+}
+
+// IsImage checks if the Content-Type is an image/* media type
+func (d ImageDetails) IsImage() bool {
+	mediaType, _, err := mime.ParseMediaType(d.ContentType)
+	return err == nil && strings.HasPrefix(mediaType, "image/")
+}
+
+// ImageSizeStrategy selects how the size of an image is found
+type ImageSizeStrategy string
+
+const (
+	// ImageSizeHead reads the Content-Length of a HEAD request, falling back to
+	// ImageSizeRange when the server doesn't send one.
+	ImageSizeHead ImageSizeStrategy = "head"
+	// ImageSizeRange reads the total size from the Content-Range of a GET for the
+	// first byte. Servers that ignore the range have their response counted up to
+	// the limit, servers that reject it fall back to ImageSizeHead.
+	ImageSizeRange ImageSizeStrategy = "range"
+)
+
+// ImageOptions configures how the details of an image are found
+type ImageOptions struct {
+	// Client makes the requests, http.DefaultClient when nil
+	Client *http.Client
+	// Limit is the most bytes read when the size can only be found by downloading
+	// the image, DefaultImageSizeLimit when zero or less
+	Limit int
+	// Strategy defaults to ImageSizeHead
+	Strategy ImageSizeStrategy
+	// UserAgent is sent with the requests, Go's default when empty
+	UserAgent string
+	// MaxRedirects is the number of requests made to reach the image, the first
+	// one included as for Go's http client, DefaultMaxRedirects when zero or less
+	MaxRedirects int
+}
+
+// GetImageDetailsWithOptions reports the size and content type of the image
+// using the strategy in the options, the requests are cancelled with the context.
+func GetImageDetailsWithOptions(ctx context.Context, url string, opts ImageOptions) (ImageDetails, error) {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultImageSizeLimit
+	}
+	opts.Client = redirectClient(opts.Client, opts.MaxRedirects)
+	if opts.Strategy == ImageSizeRange {
+		details, known, err := rangeImageDetails(ctx, url, opts)
+		if err == nil && known {
+			return details, nil
+		}
+		return headImageDetails(ctx, url, opts, false)
+	}
+	return headImageDetails(ctx, url, opts, true)
+}
+
+func headImageDetails(ctx context.Context, url string, opts ImageOptions, fallback bool) (ImageDetails, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return ImageDetails{}, err
+	}
+	setUserAgent(req, opts.UserAgent)
+	resp, err := opts.Client.Do(req) // #nosec
 	if err != nil {
-		return true, fmt.Errorf("HEAD error: %v", err)
+		return ImageDetails{}, fmt.Errorf("HEAD error: %v", err)
 	}
+	defer resp.Body.Close()
 	if sc := resp.StatusCode; sc != http.StatusOK {
-		return true, fmt.Errorf("failing %d response", sc)
+		return ImageDetails{}, fmt.Errorf("failing %d response", sc)
+	}
+	details := ImageDetails{ContentType: resp.Header.Get("Content-Type"), URL: resp.Request.URL.String()}
+	// try to get the image size from Content-Length header
+	if length := resp.Header.Get("Content-Length"); length != "" || !fallback {
+		details.Size, _ = strconv.Atoi(length)
+		return details, nil
 	}
-	size, _ := strconv.Atoi(resp.Header.Get("Content-Length"))
-	if size > limit {
-		return true, nil
+	ranged, _, err := rangeImageDetails(ctx, url, opts)
+	if err != nil {
+		return details, nil
+	}
+	if ranged.ContentType == "" {
+		ranged.ContentType = details.ContentType
+	}
+	return ranged, nil
+}
+
+// rangeImageDetails asks for the first byte of the image, reporting whether
+// the size could be found.
+func rangeImageDetails(ctx context.Context, url string, opts ImageOptions) (ImageDetails, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return ImageDetails{}, false, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	setUserAgent(req, opts.UserAgent)
+	resp, err := opts.Client.Do(req) // #nosec
+	if err != nil {
+		return ImageDetails{}, false, fmt.Errorf("GET error: %v", err)
+	}
+	defer resp.Body.Close()
+	details := ImageDetails{ContentType: resp.Header.Get("Content-Type"), URL: resp.Request.URL.String()}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Content-Range is "bytes 0-0/<size>", the size may be given as "*"
+		contentRange := resp.Header.Get("Content-Range")
+		i := strings.LastIndex(contentRange, "/")
+		if i < 0 {
+			return details, false, nil
+		}
+		size, err := strconv.Atoi(contentRange[i+1:])
+		if err != nil {
+			return details, false, nil
+		}
+		details.Size = size
+		return details, true, nil
+	case http.StatusOK:
+		// the range was ignored so the whole image is coming, count it up to the limit
+		if resp.ContentLength >= 0 {
+			details.Size = int(resp.ContentLength)
+			return details, true, nil
+		}
+		n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, int64(opts.Limit)+1))
+		if err != nil {
+			return details, false, fmt.Errorf("could not read image: %v", err)
+		}
+		details.Size = int(n)
+		return details, true, nil
+	default:
+		return details, false, fmt.Errorf("failing %d response", resp.StatusCode)
 	}
-	return false, nil
 }
 
 // IssueEventAction enumerates the triggers for this
@@ -150,6 +299,26 @@ type GenericCommentEvent struct {
 	IssueLink   string
 	GUID        string
 	HeadSha     string
+	// PreviousBody is the body before an edit, or only its commands when filled
+	// in by plugins.FillPreviousBody, empty when it isn't known
+	PreviousBody string
+	// CommentID identifies the comment, zero when the event isn't for a comment
+	CommentID int
+	// ThreadID is the discussion the comment belongs to on providers with
+	// threaded discussions, empty when unknown
+	ThreadID string
+	// AuthorAccountID is the account id of the author on Bitbucket Cloud, which
+	// the go-scm hooks don't have, empty on the other providers or when unknown
+	AuthorAccountID string
+}
+
+// AuthorMention is the author to pass to QuoteAuthorForComment: the account id
+// on Bitbucket Cloud when known, the login otherwise
+func (e *GenericCommentEvent) AuthorMention() string {
+	if e.AuthorAccountID != "" {
+		return e.AuthorAccountID
+	}
+	return e.Author.Login
 }
 
 // ReviewAction is the action that a review can be made with.
@@ -215,3 +384,26 @@ func PushHookBranch(pe *scm.PushHook) string {
 	ref = strings.TrimPrefix(ref, "refs/tags/")      // if Ref is a tag
 	return ref
 }
+
+// redirectClient is the client stopping after max requests, the first one
+// included as Go's http client counts them, so that the image checked is the
+// one found within them
+func redirectClient(client *http.Client, max int) *http.Client {
+	if max <= 0 {
+		max = DefaultMaxRedirects
+	}
+	limited := *client
+	limited.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= max {
+			return fmt.Errorf("stopped after %d redirects", max)
+		}
+		return nil
+	}
+	return &limited
+}
+
+func setUserAgent(req *http.Request, userAgent string) {
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+}
@@ -34,7 +34,7 @@ import (
 // configuration
 func (s *Server) CreateAgent(l *logrus.Entry, owner, repo, ref string) (plugins.Agent, error) {
 	start := time.Now()
-	pc := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, s.ServerURL, l)
+	pc := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.clientAgent(), s.ServerURL, l)
 	fullName := scm.Join(owner, repo)
 	if pc.Config == nil {
 		return pc, errors.Errorf("no config available. maybe the ConfigMap got deleted")
@@ -69,6 +69,16 @@ func (s *Server) CreateAgent(l *logrus.Entry, owner, repo, ref string) (plugins.
 	return pc, nil
 }
 
+// periodicAgent creates the agent the periodic tasks of the plugins run with,
+// the scm client is only known once the first webhook came in.
+func (s *Server) periodicAgent() (plugins.Agent, error) {
+	clientAgent := s.clientAgent()
+	if clientAgent == nil {
+		return plugins.Agent{}, errors.New("no scm client until the first webhook")
+	}
+	return plugins.NewAgent(s.ConfigAgent, s.Plugins, clientAgent, s.ServerURL, logrus.WithField("client", "periodic")), nil
+}
+
 func (s *Server) createAgent(pc *plugins.Agent, owner, repo, ref string) error {
 	var err error
 	cache := inrepo.NewResolverCache()
@@ -18,11 +18,15 @@ package webhook
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/jenkins-x/go-scm/scm"
@@ -47,6 +51,68 @@ type Server struct {
 
 	// Tracks running handlers for graceful shutdown
 	wg sync.WaitGroup
+	// Guards the ClientAgent, replaced by every webhook while the periodic
+	// tasks read it
+	clientAgentLock sync.RWMutex
+}
+
+// clientAgent returns the client agent of the latest webhook
+func (s *Server) clientAgent() *plugins.ClientAgent {
+	s.clientAgentLock.RLock()
+	defer s.clientAgentLock.RUnlock()
+	return s.ClientAgent
+}
+
+// setClientAgent replaces the client agent
+func (s *Server) setClientAgent(clientAgent *plugins.ClientAgent) {
+	s.clientAgentLock.Lock()
+	defer s.clientAgentLock.Unlock()
+	s.ClientAgent = clientAgent
+}
+
+// eventTimeout bounds the handling of a webhook event, the context of its
+// agent is cancelled once it passes
+const eventTimeout = 10 * time.Minute
+
+// eventHandlers runs the handlers of a single event, the context they get in
+// their agent is cancelled once they are all done or the event times out
+type eventHandlers struct {
+	server *Server
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// newEventHandlers gives the agent the context of a new event
+func (s *Server) newEventHandlers(agent *plugins.Agent) *eventHandlers {
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	agent.Context = ctx
+	return &eventHandlers{server: s, ctx: ctx, cancel: cancel}
+}
+
+// run invokes the handler async, tracked for the graceful shutdown, unless
+// the event was cancelled already
+func (e *eventHandlers) run(l *logrus.Entry, handle func()) {
+	if err := e.ctx.Err(); err != nil {
+		l.WithError(err).Warn("Abandoning the handling of the event.")
+		return
+	}
+	e.server.wg.Add(1)
+	e.wg.Add(1)
+	go func() {
+		defer e.server.wg.Done()
+		defer e.wg.Done()
+		handle()
+	}()
+}
+
+// release cancels the context of the event once the handlers run so far
+// return
+func (e *eventHandlers) release() {
+	go func() {
+		e.wg.Wait()
+		e.cancel()
+	}()
 }
 
 const failedCommentCoerceFmt = "Could not coerce %s event to a GenericCommentEvent. Unknown 'action': %q."
@@ -54,11 +120,57 @@ const failedCommentCoerceFmt = "Could not coerce %s event to a GenericCommentEve
 var zeroSha = regexp.MustCompile("\\b0{7,40}\\b")
 
 func (s *Server) getPlugins(org, repo string) map[string]plugins.Plugin {
-	return s.Plugins.GetPlugins(org, repo, s.ClientAgent.SCMProviderClient.Driver.String())
+	return s.Plugins.GetPlugins(org, repo, s.clientAgent().SCMProviderClient.Driver.String())
+}
+
+// commentDetails are the details of a comment hook missing from the go-scm
+// hooks, read from the raw payload
+type commentDetails struct {
+	// threadID, see gitlabDiscussionID
+	threadID string
+	// authorAccountID, see bitbucketAccountID
+	authorAccountID string
+}
+
+// bitbucketAccountID returns the account id of the author of a Bitbucket Cloud
+// comment hook, which mentions need, or an empty string for any other hook
+func bitbucketAccountID(header http.Header, body []byte) string {
+	event := header.Get("X-Event-Key")
+	if !strings.HasPrefix(event, "pullrequest:comment_") && !strings.HasPrefix(event, "issue:comment_") {
+		return ""
+	}
+	hook := struct {
+		Comment struct {
+			User struct {
+				AccountID string `json:"account_id"`
+			} `json:"user"`
+		} `json:"comment"`
+	}{}
+	if err := json.Unmarshal(body, &hook); err != nil {
+		return ""
+	}
+	return hook.Comment.User.AccountID
+}
+
+// gitlabDiscussionID returns the discussion of a GitLab note hook, which
+// replies are posted to, or an empty string for any other hook
+func gitlabDiscussionID(header http.Header, body []byte) string {
+	if header.Get("X-Gitlab-Event") != "Note Hook" {
+		return ""
+	}
+	note := struct {
+		ObjectAttributes struct {
+			DiscussionID string `json:"discussion_id"`
+		} `json:"object_attributes"`
+	}{}
+	if err := json.Unmarshal(body, &note); err != nil {
+		return ""
+	}
+	return note.ObjectAttributes.DiscussionID
 }
 
 // handleIssueCommentEvent handle comment events
-func (s *Server) handleIssueCommentEvent(l *logrus.Entry, ic scm.IssueCommentHook) {
+func (s *Server) handleIssueCommentEvent(l *logrus.Entry, ic scm.IssueCommentHook, details commentDetails) {
 	l = l.WithFields(logrus.Fields{
 		scmprovider.OrgLogField:  ic.Repo.Namespace,
 		scmprovider.RepoLogField: ic.Repo.Name,
@@ -68,22 +180,25 @@ func (s *Server) handleIssueCommentEvent(l *logrus.Entry, ic scm.IssueCommentHoo
 	})
 	l.Infof("Issue comment %s.", ic.Action)
 	event := &scmprovider.GenericCommentEvent{
-		GUID:        ic.GUID,
-		IsPR:        ic.Issue.PullRequest != nil,
-		Action:      ic.Action,
-		Body:        ic.Comment.Body,
-		Link:        ic.Comment.Link,
-		Number:      ic.Issue.Number,
-		Repo:        ic.Repo,
-		Author:      ic.Comment.Author,
-		IssueAuthor: ic.Issue.Author,
-		Assignees:   ic.Issue.Assignees,
-		IssueState:  ic.Issue.State,
-		IssueBody:   ic.Issue.Body,
-		IssueLink:   ic.Issue.Link,
+		GUID:            ic.GUID,
+		IsPR:            ic.Issue.PullRequest != nil,
+		Action:          ic.Action,
+		Body:            ic.Comment.Body,
+		Link:            ic.Comment.Link,
+		Number:          ic.Issue.Number,
+		CommentID:       ic.Comment.ID,
+		ThreadID:        details.threadID,
+		Repo:            ic.Repo,
+		Author:          ic.Comment.Author,
+		AuthorAccountID: details.authorAccountID,
+		IssueAuthor:     ic.Issue.Author,
+		Assignees:       ic.Issue.Assignees,
+		IssueState:      ic.Issue.State,
+		IssueBody:       ic.Issue.Body,
+		IssueLink:       ic.Issue.Link,
 	}
 	if ic.Issue.PullRequest != nil {
-		updatedPR, _, err := s.ClientAgent.SCMProviderClient.PullRequests.Find(context.Background(), fmt.Sprintf("%s/%s",
+		updatedPR, _, err := s.clientAgent().SCMProviderClient.PullRequests.Find(context.Background(), fmt.Sprintf("%s/%s",
 			ic.Repo.Namespace, ic.Repo.Name), ic.Issue.Number)
 		if err != nil {
 			l.WithError(err).Error("Error fetching Pull Request details.")
@@ -98,7 +213,7 @@ func (s *Server) handleIssueCommentEvent(l *logrus.Entry, ic scm.IssueCommentHoo
 }
 
 // handlePullRequestCommentEvent handles pull request comments events
-func (s *Server) handlePullRequestCommentEvent(l *logrus.Entry, pc scm.PullRequestCommentHook) {
+func (s *Server) handlePullRequestCommentEvent(l *logrus.Entry, pc scm.PullRequestCommentHook, details commentDetails) {
 	l = l.WithFields(logrus.Fields{
 		scmprovider.OrgLogField:  pc.Repo.Namespace,
 		scmprovider.RepoLogField: pc.Repo.Name,
@@ -111,20 +226,23 @@ func (s *Server) handlePullRequestCommentEvent(l *logrus.Entry, pc scm.PullReque
 	s.handleGenericComment(
 		l,
 		&scmprovider.GenericCommentEvent{
-			GUID:        pc.GUID,
-			IsPR:        true,
-			Action:      pc.Action,
-			Body:        pc.Comment.Body,
-			Link:        pc.Comment.Link,
-			Number:      pc.PullRequest.Number,
-			Repo:        pc.Repo,
-			Author:      pc.Comment.Author,
-			IssueAuthor: pc.PullRequest.Author,
-			Assignees:   pc.PullRequest.Assignees,
-			IssueState:  pc.PullRequest.State,
-			IssueBody:   pc.PullRequest.Body,
-			IssueLink:   pc.PullRequest.Link,
-			HeadSha:     pc.PullRequest.Head.Sha,
+			GUID:            pc.GUID,
+			IsPR:            true,
+			Action:          pc.Action,
+			Body:            pc.Comment.Body,
+			Link:            pc.Comment.Link,
+			Number:          pc.PullRequest.Number,
+			CommentID:       pc.Comment.ID,
+			ThreadID:        details.threadID,
+			Repo:            pc.Repo,
+			Author:          pc.Comment.Author,
+			AuthorAccountID: details.authorAccountID,
+			IssueAuthor:     pc.PullRequest.Author,
+			Assignees:       pc.PullRequest.Assignees,
+			IssueState:      pc.PullRequest.State,
+			IssueBody:       pc.PullRequest.Body,
+			IssueLink:       pc.PullRequest.Link,
+			HeadSha:         pc.PullRequest.Head.Sha,
 		},
 	)
 }
@@ -142,30 +260,31 @@ func (s *Server) handleGenericComment(l *logrus.Entry, ce *scmprovider.GenericCo
 			ce.Repo.Name,
 			ce.Number,
 		)
-		s.handleGenericCommentWithAgent(l, ce, agent)
+		handlers := s.newEventHandlers(&agent)
+		defer handlers.release()
+		s.handleGenericCommentWithAgent(l, ce, agent, handlers)
 	}()
 }
 
-func (s *Server) handleGenericCommentWithAgent(l *logrus.Entry, ce *scmprovider.GenericCommentEvent, agent plugins.Agent) {
-	for p, h := range s.getPlugins(ce.Repo.Namespace, ce.Repo.Name) {
+func (s *Server) handleGenericCommentWithAgent(l *logrus.Entry, ce *scmprovider.GenericCommentEvent, agent plugins.Agent, handlers *eventHandlers) {
+	repoPlugins := s.getPlugins(ce.Repo.Namespace, ce.Repo.Name)
+	plugins.FillPreviousBody(ce, repoPlugins)
+	for p, h := range repoPlugins {
 		if h.GenericCommentHandler != nil {
-			s.wg.Add(1)
-			go func(p string, h plugins.GenericCommentHandler) {
-				defer s.wg.Done()
+			h := h.GenericCommentHandler
+			handlers.run(l, func() {
 				if err := h(agent, *ce); err != nil {
 					agent.Logger.WithError(err).Error("Error handling GenericCommentEvent.")
 				}
-			}(p, h.GenericCommentHandler)
+			})
 		}
 		for _, cmd := range h.Commands {
-			err := cmd.InvokeCommandHandler(ce, func(handler plugins.CommandEventHandler, e *scmprovider.GenericCommentEvent, match plugins.CommandMatch) error {
-				s.wg.Add(1)
-				go func(p string, h plugins.CommandEventHandler, m plugins.CommandMatch) {
-					defer s.wg.Done()
-					if err := h(m, agent, *ce); err != nil {
+			err := cmd.InvokeCommandHandlerFor(p, ce, func(handler plugins.CommandEventHandler, e *scmprovider.GenericCommentEvent, match plugins.CommandMatch) error {
+				handlers.run(l, func() {
+					if err := handler(match, agent, *ce); err != nil {
 						agent.Logger.WithError(err).Error("Error handling GenericCommentEvent.")
 					}
-				}(p, handler, match)
+				})
 				return nil
 			})
 			if err != nil {
@@ -202,16 +321,17 @@ func (s *Server) handlePushEvent(l *logrus.Entry, pe *scm.PushHook) {
 			agent.Logger.WithError(err).Error("Error creating agent for PushEvent.")
 			return
 		}
-		for p, h := range s.getPlugins(pe.Repo.Namespace, pe.Repo.Name) {
+		handlers := s.newEventHandlers(&agent)
+		defer handlers.release()
+		for _, h := range s.getPlugins(pe.Repo.Namespace, pe.Repo.Name) {
 			if h.PushEventHandler != nil {
-				s.wg.Add(1)
 				c++
-				go func(p string, h plugins.PushEventHandler) {
-					defer s.wg.Done()
+				h := h.PushEventHandler
+				handlers.run(l, func() {
 					if err := h(agent, *pe); err != nil {
 						agent.Logger.WithError(err).Error("Error handling PushEvent.")
 					}
-				}(p, h.PushEventHandler)
+				})
 			}
 		}
 		l.WithField("count", strconv.Itoa(c)).Info("number of push handlers")
@@ -249,16 +369,17 @@ func (s *Server) handlePullRequestEvent(l *logrus.Entry, pr *scm.PullRequestHook
 			pr.Repo.Name,
 			pr.PullRequest.Number,
 		)
+		handlers := s.newEventHandlers(&agent)
+		defer handlers.release()
 		for p, h := range s.getPlugins(repo.Namespace, repo.Name) {
 			if h.PullRequestHandler != nil {
-				s.wg.Add(1)
 				c++
-				go func(p string, h plugins.PullRequestHandler) {
-					defer s.wg.Done()
+				p, h := p, h.PullRequestHandler
+				handlers.run(l, func() {
 					if err := h(agent, *pr); err != nil {
 						agent.Logger.WithField("plugin", p).WithError(err).Error("Error handling PullRequestEvent.")
 					}
-				}(p, h.PullRequestHandler)
+				})
 			}
 		}
 		l.WithField("count", strconv.Itoa(c)).Info("number of PR handlers")
@@ -285,6 +406,7 @@ func (s *Server) handlePullRequestEvent(l *logrus.Entry, pr *scm.PullRequestHook
 				HeadSha:     pr.PullRequest.Head.Sha,
 			},
 			agent,
+			handlers,
 		)
 	}()
 }
@@ -319,15 +441,16 @@ func (s *Server) handleReviewEvent(l *logrus.Entry, re scm.ReviewHook) {
 			re.Repo.Name,
 			re.PullRequest.Number,
 		)
-		for p, h := range s.getPlugins(re.PullRequest.Base.Repo.Namespace, re.PullRequest.Base.Repo.Name) {
+		handlers := s.newEventHandlers(&agent)
+		defer handlers.release()
+		for _, h := range s.getPlugins(re.PullRequest.Base.Repo.Namespace, re.PullRequest.Base.Repo.Name) {
 			if h.ReviewEventHandler != nil {
-				s.wg.Add(1)
-				go func(p string, h plugins.ReviewEventHandler) {
-					defer s.wg.Done()
+				h := h.ReviewEventHandler
+				handlers.run(l, func() {
 					if err := h(agent, re); err != nil {
 						agent.Logger.WithError(err).Error("Error handling ReviewEvent.")
 					}
-				}(p, h.ReviewEventHandler)
+				})
 			}
 		}
 
@@ -354,6 +477,7 @@ func (s *Server) handleReviewEvent(l *logrus.Entry, re scm.ReviewHook) {
 				HeadSha:     re.PullRequest.Head.Sha,
 			},
 			agent,
+			handlers,
 		)
 	}()
 }
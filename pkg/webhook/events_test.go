@@ -0,0 +1,205 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/lighthouse/pkg/config"
+	"github.com/jenkins-x/lighthouse/pkg/plugins"
+	"github.com/jenkins-x/lighthouse/pkg/scmprovider"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitlabDiscussionID(t *testing.T) {
+	note := []byte(`{"object_kind":"note","object_attributes":{"id":7,"discussion_id":"abc123"}}`)
+	testcases := []struct {
+		name     string
+		event    string
+		body     []byte
+		expected string
+	}{
+		{name: "note hook", event: "Note Hook", body: note, expected: "abc123"},
+		{name: "other hook", event: "Merge Request Hook", body: note},
+		{name: "no header", body: note},
+		{name: "no discussion", event: "Note Hook", body: []byte(`{"object_attributes":{"id":7}}`)},
+		{name: "invalid body", event: "Note Hook", body: []byte(`{`)},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			header := http.Header{}
+			if tc.event != "" {
+				header.Set("X-Gitlab-Event", tc.event)
+			}
+			assert.Equal(t, tc.expected, gitlabDiscussionID(header, tc.body))
+		})
+	}
+}
+
+func TestBitbucketAccountID(t *testing.T) {
+	comment := []byte(`{
+  "comment": {
+    "id": 7,
+    "content": {"raw": "/meow"},
+    "user": {"display_name": "Jane Doe", "nickname": "jdoe", "account_id": "557058:c0b7ab22-3c0c-4c5b-8f3e-8b0e2d0e7c1a", "uuid": "{d4c2ab38-4d8a-4ad0-9c2e-8f2b5a1b0e7c}"}
+  },
+  "actor": {"display_name": "Jane Doe", "account_id": "557058:c0b7ab22-3c0c-4c5b-8f3e-8b0e2d0e7c1a"}
+}`)
+	testcases := []struct {
+		name     string
+		event    string
+		body     []byte
+		expected string
+	}{
+		{name: "pull request comment", event: "pullrequest:comment_created", body: comment, expected: "557058:c0b7ab22-3c0c-4c5b-8f3e-8b0e2d0e7c1a"},
+		{name: "edited pull request comment", event: "pullrequest:comment_updated", body: comment, expected: "557058:c0b7ab22-3c0c-4c5b-8f3e-8b0e2d0e7c1a"},
+		{name: "issue comment", event: "issue:comment_created", body: comment, expected: "557058:c0b7ab22-3c0c-4c5b-8f3e-8b0e2d0e7c1a"},
+		{name: "bitbucket server comment", event: "pr:comment:added", body: comment},
+		{name: "other hook", event: "repo:push", body: comment},
+		{name: "no account id", event: "pullrequest:comment_created", body: []byte(`{"comment":{"user":{"nickname":"jdoe"}}}`)},
+		{name: "invalid body", event: "pullrequest:comment_created", body: []byte(`{`)},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			header := http.Header{}
+			if tc.event != "" {
+				header.Set("X-Event-Key", tc.event)
+			}
+			assert.Equal(t, tc.expected, bitbucketAccountID(header, tc.body))
+		})
+	}
+}
+
+func TestGitlabNoteRepliesInThread(t *testing.T) {
+	paths := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			paths <- r.URL.EscapedPath()
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL + "/")
+	require.NoError(t, err)
+
+	plugins.RegisterPlugin("thread-reply", plugins.Plugin{
+		GenericCommentHandler: func(pc plugins.Agent, e scmprovider.GenericCommentEvent) error {
+			return pc.SCMProviderClient.CreateCommentReply(e.Repo.Namespace, e.Repo.Name, e.Number, e.IsPR, e.ThreadID, "reply")
+		},
+	})
+	pluginAgent := &plugins.ConfigAgent{}
+	pluginAgent.Set(&plugins.Configuration{
+		Plugins: map[string][]string{"test-org/test-repo": {"thread-reply"}},
+	})
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+	configBytes, err := os.ReadFile(fmt.Sprintf("%s/test_data/test_config.yaml", workDir))
+	require.NoError(t, err)
+	loadedConfig, err := config.LoadYAMLConfig(configBytes)
+	require.NoError(t, err)
+	configAgent := &config.Agent{}
+	configAgent.Set(loadedConfig)
+
+	o := &WebhooksController{
+		server: &Server{
+			ConfigAgent: configAgent,
+			Plugins:     pluginAgent,
+			ClientAgent: &plugins.ClientAgent{
+				BotName:           "bot",
+				SCMProviderClient: &scm.Client{Driver: scm.DriverGitlab, BaseURL: u},
+			},
+		},
+	}
+	webhook := &scm.PullRequestCommentHook{
+		Action: scm.ActionCreate,
+		Repo: scm.Repository{
+			Namespace: "test-org",
+			Name:      "test-repo",
+			FullName:  "test-org/test-repo",
+		},
+		PullRequest: scm.PullRequest{Number: 5},
+		Comment:     scm.Comment{ID: 7, Body: "/meow"},
+	}
+	header := http.Header{}
+	header.Set("X-Gitlab-Event", "Note Hook")
+	threadID := gitlabDiscussionID(header, []byte(`{"object_attributes":{"discussion_id":"abc123"}}`))
+
+	_, message, err := o.processWebHook(logrus.WithField("test", t.Name()), webhook, commentDetails{threadID: threadID})
+	require.NoError(t, err)
+	assert.Equal(t, "processed PR comment hook", message)
+
+	select {
+	case path := <-paths:
+		assert.Equal(t, "/api/v4/projects/test-org%2Ftest-repo/merge_requests/5/discussions/abc123/notes", path)
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected a reply in the thread of the note")
+	}
+	o.server.wg.Wait()
+}
+
+func TestGenericCommentEventContext(t *testing.T) {
+	handled := make(chan error, 1)
+	plugins.RegisterPlugin("event-context", plugins.Plugin{
+		GenericCommentHandler: func(pc plugins.Agent, e scmprovider.GenericCommentEvent) error {
+			if _, ok := pc.Context.Deadline(); !ok {
+				handled <- fmt.Errorf("expected the event context to have a deadline")
+				return nil
+			}
+			handled <- pc.Context.Err()
+			return nil
+		},
+	})
+	pluginAgent := &plugins.ConfigAgent{}
+	pluginAgent.Set(&plugins.Configuration{
+		Plugins: map[string][]string{"test-org/test-repo": {"event-context"}},
+	})
+	event := &scmprovider.GenericCommentEvent{
+		Action: scm.ActionCreate,
+		Repo:   scm.Repository{Namespace: "test-org", Name: "test-repo"},
+		Body:   "/meow",
+	}
+
+	testcases := []struct {
+		name      string
+		cancelled bool
+	}{
+		{name: "live event"},
+		{name: "cancelled event", cancelled: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{
+				Plugins: pluginAgent,
+				ClientAgent: &plugins.ClientAgent{
+					SCMProviderClient: &scm.Client{Driver: scm.DriverGithub},
+				},
+			}
+			l := logrus.WithField("test", t.Name())
+			agent := plugins.Agent{Logger: l}
+			handlers := s.newEventHandlers(&agent)
+			if tc.cancelled {
+				handlers.cancel()
+			}
+			s.handleGenericCommentWithAgent(l, event, agent, handlers)
+			handlers.release()
+			s.wg.Wait()
+
+			select {
+			case err := <-handled:
+				assert.False(t, tc.cancelled, "expected a cancelled event not to be handled")
+				assert.NoError(t, err)
+			default:
+				assert.True(t, tc.cancelled, "expected the event to be handled")
+			}
+			<-agent.Context.Done()
+		})
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/jenkins-x/lighthouse/pkg/filebrowser"
 	"github.com/jenkins-x/lighthouse/pkg/git"
 	gitv2 "github.com/jenkins-x/lighthouse/pkg/git/v2"
+	"github.com/jenkins-x/lighthouse/pkg/interrupts"
 	"github.com/jenkins-x/lighthouse/pkg/launcher"
 	"github.com/jenkins-x/lighthouse/pkg/metrics"
 	"github.com/jenkins-x/lighthouse/pkg/plugins"
@@ -47,6 +48,7 @@ type WebhooksController struct {
 	launcher                launcher.PipelineLauncher
 	disabledExternalPlugins []string
 	logWebHooks             bool
+	dryRun                  bool
 }
 
 // NewWebhooksController creates and configures the controller
@@ -58,10 +60,14 @@ func NewWebhooksController(path, namespace, botName, pluginFilename, configFilen
 		configFilename: configFilename,
 		botName:        botName,
 		logWebHooks:    os.Getenv("LIGHTHOUSE_LOG_WEBHOOKS") == "true",
+		dryRun:         os.Getenv("LIGHTHOUSE_DRY_RUN") == "true",
 	}
 	if o.logWebHooks {
 		logrus.Info("enabling webhook logging")
 	}
+	if o.dryRun {
+		logrus.Info("enabling dry run, plugins will log comments instead of creating them")
+	}
 	var err error
 	o.server, err = o.createHookServer()
 	if err != nil {
@@ -81,6 +87,13 @@ func NewWebhooksController(path, namespace, botName, pluginFilename, configFilen
 	}
 	o.launcher = launcher.NewLauncher(lhClient, o.namespace)
 
+	scheduler := &plugins.Scheduler{
+		Config: o.server.Plugins.Config,
+		Agent:  o.server.periodicAgent,
+	}
+	// the scheduler idles until a schedule is configured
+	interrupts.Run(scheduler.Run)
+
 	return o, nil
 }
 
@@ -108,6 +121,29 @@ func (o *WebhooksController) Ready(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// PluginHealth returns HTTP 200 if the upstream dependencies of the enabled plugins are available, otherwise HTTP 503.
+// The body reports the health of each plugin that has a health check.
+func (o *WebhooksController) PluginHealth(w http.ResponseWriter, r *http.Request) {
+	logrus.Debug("Plugin health check")
+	status := http.StatusOK
+	results := map[string]string{}
+	if o.server != nil && o.server.Plugins != nil && o.server.Plugins.Config() != nil {
+		for name, err := range plugins.CheckHealth(o.server.Plugins.Config()) {
+			if err != nil {
+				status = http.StatusServiceUnavailable
+				results[name] = err.Error()
+				continue
+			}
+			results[name] = "ok"
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		logrus.WithError(err).Error("failed to write plugin health")
+	}
+}
+
 // Metrics returns the prometheus metrics
 func (o *WebhooksController) Metrics(w http.ResponseWriter, r *http.Request) {
 	promhttp.Handler().ServeHTTP(w, r)
@@ -250,14 +286,15 @@ func (o *WebhooksController) handleWebhookOrPollRequest(w http.ResponseWriter, r
 	})
 	util.AddAuthToSCMClient(scmClient, token, ghaSecretDir != "")
 
-	o.server.ClientAgent = &plugins.ClientAgent{
+	o.server.setClientAgent(&plugins.ClientAgent{
 		BotName:           util.GetBotName(cfg),
 		SCMProviderClient: scmClient,
 		KubernetesClient:  kubeClient,
 		GitClient:         o.gitClient,
 		LighthouseClient:  lhClient.LighthouseV1alpha1().LighthouseJobs(o.namespace),
 		LauncherClient:    o.launcher,
-	}
+		DryRun:            o.dryRun,
+	})
 
 	if o.server.FileBrowsers == nil {
 		configureOpts := func(opts *gitv2.ClientFactoryOpts) {
@@ -303,7 +340,14 @@ func (o *WebhooksController) handleWebhookOrPollRequest(w http.ResponseWriter, r
 		}
 	}
 
-	l, output, err := o.ProcessWebHook(entry, webhook)
+	details := commentDetails{}
+	switch scmClient.Driver {
+	case scm.DriverGitlab:
+		details.threadID = gitlabDiscussionID(r.Header, bodyBytes)
+	case scm.DriverBitbucket:
+		details.authorAccountID = bitbucketAccountID(r.Header, bodyBytes)
+	}
+	l, output, err := o.processWebHook(entry, webhook, details)
 	if err != nil {
 		responseHTTPError(w, http.StatusInternalServerError, fmt.Sprintf("500 Internal Server Error: %s", err.Error()))
 	}
@@ -320,6 +364,12 @@ func (o *WebhooksController) handleWebhookOrPollRequest(w http.ResponseWriter, r
 
 // ProcessWebHook process a webhook
 func (o *WebhooksController) ProcessWebHook(l *logrus.Entry, webhook scm.Webhook) (*logrus.Entry, string, error) {
+	return o.processWebHook(l, webhook, commentDetails{})
+}
+
+// processWebHook processes a webhook, its comments having the details read from
+// the raw payload, if any
+func (o *WebhooksController) processWebHook(l *logrus.Entry, webhook scm.Webhook, details commentDetails) (*logrus.Entry, string, error) {
 	repository := webhook.Repository()
 	fields := map[string]interface{}{
 		"Namespace": repository.Namespace,
@@ -426,7 +476,7 @@ func (o *WebhooksController) ProcessWebHook(l *logrus.Entry, webhook scm.Webhook
 
 		l.Info("invoking Issue Comment handler")
 
-		o.server.handleIssueCommentEvent(l, *issueCommentHook)
+		o.server.handleIssueCommentEvent(l, *issueCommentHook, details)
 		return l, "processed issue comment hook", nil
 	}
 	prCommentHook, ok := webhook.(*scm.PullRequestCommentHook)
@@ -451,7 +501,7 @@ func (o *WebhooksController) ProcessWebHook(l *logrus.Entry, webhook scm.Webhook
 
 		l.Info("invoking Issue Comment handler")
 
-		o.server.handlePullRequestCommentEvent(l, *prCommentHook)
+		o.server.handlePullRequestCommentEvent(l, *prCommentHook, details)
 		return l, "processed PR comment hook", nil
 	}
 	prReviewHook, ok := webhook.(*scm.ReviewHook)